@@ -0,0 +1,111 @@
+package part10
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOverloaded = errors.New("overloaded")
+	ErrShed       = errors.New("shed")
+)
+
+// AdmissionController sheds load by queueing delay rather than queue length,
+// in the manner of CoDel: once every job started over an Interval waited
+// longer than Target, the scheduler is overloaded. While overloaded, new
+// submissions are rejected with ErrOverloaded and queued jobs that waited
+// longer than Target are shed with ErrShed instead of run. The first job to
+// start within Target, or the end of a Run, ends the overload.
+type AdmissionController struct {
+	Target   time.Duration
+	Interval time.Duration
+
+	mu         sync.Mutex
+	delay      ewma
+	firstAbove time.Time
+	overloaded bool
+	shed       uint64
+	rejected   uint64
+}
+
+// AdmissionStats reports the shed and rejected counts, the smoothed queueing
+// delay of started jobs and whether the scheduler is overloaded.
+type AdmissionStats struct {
+	Shed       uint64
+	Rejected   uint64
+	Delay      time.Duration
+	Overloaded bool
+}
+
+// NewAdmissionController keeps the standing queueing delay under target, with
+// CoDel's suggested interval of 20 times the target.
+func NewAdmissionController(target time.Duration) *AdmissionController {
+	return &AdmissionController{
+		Target:   target,
+		Interval: 20 * target,
+		delay:    ewma{alpha: 0.1},
+	}
+}
+
+// WithAdmissionControl rejects and sheds work under a as queueing delay grows.
+// A job's wait is measured from Add, or from its release for delayed jobs and
+// retries, until a worker starts it.
+func WithAdmissionControl(a *AdmissionController) Option {
+	return func(s *Scheduler) {
+		s.admission = a
+	}
+}
+
+func (a *AdmissionController) Stats() AdmissionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return AdmissionStats{a.shed, a.rejected, time.Duration(a.delay.value), a.overloaded}
+}
+
+// admit reports whether a new submission may be queued.
+func (a *AdmissionController) admit() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.overloaded {
+		a.rejected++
+	}
+
+	return !a.overloaded
+}
+
+// start records the wait of a job a worker is about to start at now and
+// reports whether to shed it instead.
+func (a *AdmissionController) start(queued, now time.Time) bool {
+	sojourn := now.Sub(queued)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.delay.add(float64(sojourn))
+
+	switch {
+	case sojourn <= a.Target:
+		a.firstAbove, a.overloaded = time.Time{}, false
+	case a.firstAbove.IsZero():
+		a.firstAbove = now.Add(a.Interval)
+	case !now.Before(a.firstAbove):
+		a.overloaded = true
+	}
+
+	if a.overloaded {
+		a.shed++
+	}
+
+	return a.overloaded
+}
+
+// idle ends an overload once no job is left waiting.
+func (a *AdmissionController) idle() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.firstAbove, a.overloaded = time.Time{}, false
+}
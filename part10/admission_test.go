@@ -0,0 +1,84 @@
+package part10_test
+
+import (
+	"context"
+	. "part10"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_shed_and_reject_under_standing_delay(t *testing.T) {
+	a := NewAdmissionController(time.Millisecond)
+	s := NewScheduler(2, 0, WithAdmissionControl(a))
+
+	// Holds one worker until the other has queued up enough delay
+	s.Add(func() interface{} {
+		for deadline := time.Now().Add(time.Second); !a.Stats().Overloaded; {
+			if time.Now().After(deadline) {
+				return nil
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		_, err := s.AddContext(context.Background(), constant(0))
+		return err
+	})
+
+	for i := 1; i <= 10; i++ {
+		s.Add(func() interface{} {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+	}
+
+	actual := s.Run()
+
+	if actual[0].Value != ErrOverloaded {
+		t.Errorf("Wanted %v while overloaded, got %v", ErrOverloaded, actual[0].Value)
+	}
+
+	if actual[1].Err != nil {
+		t.Errorf("Wanted the first job to run, got %v", actual[1].Err)
+	}
+
+	if actual[10].Err != ErrShed {
+		t.Errorf("Wanted the last job to be shed, got %v", actual[10].Err)
+	}
+
+	shed := 0
+	for _, result := range actual {
+		if result.Err == ErrShed {
+			shed++
+		}
+	}
+
+	stats := a.Stats()
+	if stats.Shed != uint64(shed) || stats.Rejected != 1 {
+		t.Errorf("Wanted %v shed and 1 rejected, got %+v", shed, stats)
+	}
+
+	if stats.Delay <= time.Millisecond || stats.Overloaded {
+		t.Errorf("Wanted a delay above target and the overload ended with Run, got %+v", stats)
+	}
+}
+
+func TestScheduler_should_admit_work_within_target(t *testing.T) {
+	a := NewAdmissionController(time.Second)
+	s := NewScheduler(4, 0, WithAdmissionControl(a))
+
+	for i := 0; i < 100; i++ {
+		if _, err := s.AddContext(context.Background(), constant(i)); err != nil {
+			t.Fatalf("Wanted no error, got %v", err)
+		}
+	}
+
+	for i, result := range s.Run() {
+		if result.Value != i || result.Err != nil {
+			t.Fatalf("Wanted %v, got %v", i, result)
+		}
+	}
+
+	if stats := a.Stats(); stats.Shed != 0 || stats.Rejected != 0 {
+		t.Errorf("Wanted nothing shed or rejected, got %+v", stats)
+	}
+}
@@ -0,0 +1,153 @@
+package part10
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// CgroupRoot is where DefaultWorkers looks for the cgroup CPU controller
+// files. The files read are those of the cgroup mounted there, which inside a
+// container with its own cgroup namespace is the container's cgroup.
+var CgroupRoot = "/sys/fs/cgroup"
+
+// CPUSource names what decided the default worker count.
+type CPUSource int
+
+const (
+	SourceNumCPU CPUSource = iota
+	SourceCPUMax
+	SourceCFSQuota
+	SourceCpuset
+)
+
+func (s CPUSource) String() string {
+	switch s {
+	case SourceNumCPU:
+		return "NumCPU"
+	case SourceCPUMax:
+		return "cpu.max"
+	case SourceCFSQuota:
+		return "cpu.cfs_quota_us"
+	case SourceCpuset:
+		return "cpuset"
+	}
+
+	return "CPUSource(" + strconv.Itoa(int(s)) + ")"
+}
+
+// DefaultWorkers returns the worker count used when 0 is passed for
+// maxThreads, and what decided it: the CPU quota or cpuset of the cgroup
+// under CgroupRoot when it is tighter than runtime.NumCPU(), otherwise
+// runtime.NumCPU().
+func DefaultWorkers() (int, CPUSource) {
+	workers, source := runtime.NumCPU(), SourceNumCPU
+
+	if limit, limitSource, ok := CgroupCPULimit(CgroupRoot); ok && limit <= workers {
+		workers, source = limit, limitSource
+	}
+
+	return workers, source
+}
+
+// CgroupCPULimit reads the CPU limit of the cgroup mounted at root from the
+// cgroup v2 cpu.max and cpuset.cpus.effective files, or the cgroup v1
+// cpu.cfs_quota_us and cpuset.cpus files. A fractional quota is rounded up.
+// Missing, unlimited or malformed files are skipped; ok is false when none of
+// them sets a limit.
+func CgroupCPULimit(root string) (limit int, source CPUSource, ok bool) {
+	consider := func(n int, s CPUSource) {
+		if n > 0 && (!ok || n < limit) {
+			limit, source, ok = n, s, true
+		}
+	}
+
+	consider(readCPUMax(filepath.Join(root, "cpu.max")), SourceCPUMax)
+
+	for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+		consider(readCFSQuota(filepath.Join(root, dir)), SourceCFSQuota)
+	}
+
+	for _, path := range []string{
+		filepath.Join(root, "cpuset.cpus.effective"),
+		filepath.Join(root, "cpuset", "cpuset.cpus"),
+	} {
+		consider(readCpuset(path), SourceCpuset)
+	}
+
+	return limit, source, ok
+}
+
+func readCgroupFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// readCPUMax parses "$MAX $PERIOD", where $MAX is "max" when unlimited.
+func readCPUMax(path string) int {
+	fields := strings.Fields(readCgroupFile(path))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+
+	return quotaCPUs(fields[0], fields[1])
+}
+
+// readCFSQuota parses cpu.cfs_quota_us, which is -1 when unlimited, against
+// cpu.cfs_period_us in dir.
+func readCFSQuota(dir string) int {
+	return quotaCPUs(
+		readCgroupFile(filepath.Join(dir, "cpu.cfs_quota_us")),
+		readCgroupFile(filepath.Join(dir, "cpu.cfs_period_us")),
+	)
+}
+
+func quotaCPUs(quota, period string) int {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+
+	return int((q + p - 1) / p)
+}
+
+// readCpuset counts the CPUs in a list such as "0-3,8,10-11".
+func readCpuset(path string) int {
+	list := readCgroupFile(path)
+	if list == "" {
+		return 0
+	}
+
+	count := 0
+	for _, part := range strings.Split(list, ",") {
+		low, high, isRange := strings.Cut(part, "-")
+		if !isRange {
+			high = low
+		}
+
+		l, err := strconv.Atoi(low)
+		if err != nil {
+			return 0
+		}
+
+		h, err := strconv.Atoi(high)
+		if err != nil || h < l {
+			return 0
+		}
+
+		count += h - l + 1
+	}
+
+	return count
+}
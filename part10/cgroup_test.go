@@ -0,0 +1,90 @@
+package part10_test
+
+import (
+	"os"
+	. "part10"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeCgroup writes files, keyed by path relative to the returned root.
+func fakeCgroup(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestCgroupCPULimit_should_read_quota_and_cpuset(t *testing.T) {
+	cases := []struct {
+		name   string
+		files  map[string]string
+		limit  int
+		source CPUSource
+		ok     bool
+	}{
+		{"none", nil, 0, SourceNumCPU, false},
+		{"v2 quota", map[string]string{"cpu.max": "250000 100000"}, 3, SourceCPUMax, true},
+		{"v2 unlimited", map[string]string{"cpu.max": "max 100000"}, 0, SourceNumCPU, false},
+		{"v2 cpuset", map[string]string{
+			"cpu.max":               "max 100000",
+			"cpuset.cpus.effective": "0-1,4",
+		}, 3, SourceCpuset, true},
+		{"v1 quota", map[string]string{
+			"cpu,cpuacct/cpu.cfs_quota_us":  "50000",
+			"cpu,cpuacct/cpu.cfs_period_us": "100000",
+		}, 1, SourceCFSQuota, true},
+		{"v1 unlimited", map[string]string{
+			"cpu/cpu.cfs_quota_us":  "-1",
+			"cpu/cpu.cfs_period_us": "100000",
+		}, 0, SourceNumCPU, false},
+		{"v1 tighter cpuset", map[string]string{
+			"cpu/cpu.cfs_quota_us":  "400000",
+			"cpu/cpu.cfs_period_us": "100000",
+			"cpuset/cpuset.cpus":    "2-3",
+		}, 2, SourceCpuset, true},
+		{"malformed", map[string]string{
+			"cpu.max":               "lots",
+			"cpuset.cpus.effective": "3-1",
+		}, 0, SourceNumCPU, false},
+	}
+
+	for _, c := range cases {
+		limit, source, ok := CgroupCPULimit(fakeCgroup(t, c.files))
+
+		if limit != c.limit || source != c.source || ok != c.ok {
+			t.Errorf("%v: wanted %v %v %v, got %v %v %v", c.name, c.limit, c.source, c.ok, limit, source, ok)
+		}
+	}
+}
+
+func TestDefaultWorkers_should_follow_the_cgroup_root(t *testing.T) {
+	defer func(root string) { CgroupRoot = root }(CgroupRoot)
+
+	CgroupRoot = fakeCgroup(t, map[string]string{"cpu.max": "100000 100000"})
+
+	if workers, source := DefaultWorkers(); workers != 1 || source != SourceCPUMax {
+		t.Errorf("Wanted 1 worker from cpu.max, got %v from %v", workers, source)
+	}
+
+	if limit := NewScheduler(0, 0).Limit(); limit != 1 {
+		t.Errorf("Wanted NewScheduler to default to 1 worker, got %v", limit)
+	}
+
+	CgroupRoot = fakeCgroup(t, nil)
+
+	if workers, source := DefaultWorkers(); workers != runtime.NumCPU() || source != SourceNumCPU {
+		t.Errorf("Wanted %v workers from NumCPU, got %v from %v", runtime.NumCPU(), workers, source)
+	}
+}
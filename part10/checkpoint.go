@@ -0,0 +1,218 @@
+package part10
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Checkpoint persists completed job results so an interrupted Run can resume
+// where it stopped. Each completion is appended to the checkpoint file as a
+// single line, so a crash loses at most the line being written. Results are
+// keyed by the job's position in its Run and by that Run's sequence number on
+// the scheduler, so the first Run of a resumed scheduler picks up the first
+// Run recorded, the second Run the second, and so on.
+//
+// Values are stored with encoding/gob; values of non-basic types must be
+// registered with gob.Register before they can be checkpointed.
+type Checkpoint struct {
+	batchID   string
+	mu        sync.Mutex
+	file      *os.File
+	completed map[checkpointKey]Result
+}
+
+type checkpointKey struct {
+	run   int
+	index int
+}
+
+type checkpointRecord struct {
+	Batch string
+	Run   int
+	Index int
+	Value interface{}
+	Err   string
+}
+
+// OpenCheckpoint opens or creates the checkpoint file at path. Completed jobs
+// recorded under the same batchID are loaded and skipped by the matching Run;
+// a file written for a different batch is discarded.
+func OpenCheckpoint(path, batchID string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{
+		batchID:   batchID,
+		file:      file,
+		completed: make(map[checkpointKey]Result),
+	}
+
+	if err := c.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func WithCheckpoint(c *Checkpoint) Option {
+	return func(s *Scheduler) {
+		s.checkpoint = c
+	}
+}
+
+// Completed returns the number of jobs already recorded for this batch.
+func (c *Checkpoint) Completed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.completed)
+}
+
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
+
+// load reads every intact record for the batch and truncates the file after
+// the last one, dropping a torn trailing line or records of another batch.
+func (c *Checkpoint) load() error {
+	reader := bufio.NewReader(c.file)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var record checkpointRecord
+		if err := decodeLine(line, &record); err != nil {
+			break
+		}
+
+		if record.Batch != c.batchID {
+			offset = 0
+			c.completed = make(map[checkpointKey]Result)
+			break
+		}
+
+		c.completed[checkpointKey{record.Run, record.Index}] = Result{Value: record.Value, Err: restoreError(record.Err)}
+		offset += int64(len(line))
+	}
+
+	if err := c.file.Truncate(offset); err != nil {
+		return err
+	}
+
+	_, err := c.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (c *Checkpoint) lookup(run, index int) (Result, bool) {
+	if c == nil {
+		return Result{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result, ok := c.completed[checkpointKey{run, index}]
+	return result, ok
+}
+
+func (c *Checkpoint) record(run, index int, result Result) error {
+	if c == nil {
+		return nil
+	}
+
+	line, err := encodeLine(&checkpointRecord{
+		Batch: c.batchID,
+		Run:   run,
+		Index: index,
+		Value: result.Value,
+		Err:   errorString(result.Err),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.file.Write(line); err != nil {
+		return err
+	}
+
+	c.completed[checkpointKey{run, index}] = result
+	return nil
+}
+
+// encodeLine gob-encodes record as a self-contained, newline-terminated base64
+// line, so files of records can be appended to and resumed after a crash.
+func encodeLine(record interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+		return nil, err
+	}
+
+	line := make([]byte, base64.StdEncoding.EncodedLen(buf.Len())+1)
+	base64.StdEncoding.Encode(line, buf.Bytes())
+	line[len(line)-1] = '\n'
+
+	return line, nil
+}
+
+func decodeLine(line []byte, record interface{}) error {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+
+	raw := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(raw, line)
+	if err != nil {
+		return err
+	}
+
+	return gob.NewDecoder(bytes.NewReader(raw[:n])).Decode(record)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+// restoreError rebuilds a persisted error, mapping known sentinels back so
+// callers can keep comparing against them.
+func restoreError(msg string) error {
+	switch msg {
+	case "":
+		return nil
+	case Timeout.Error():
+		return Timeout
+	}
+
+	if strings.HasPrefix(msg, Timeout.Error()+" ") {
+		return fmt.Errorf("%w%s", Timeout, strings.TrimPrefix(msg, Timeout.Error()))
+	}
+
+	if strings.HasPrefix(msg, ErrPanicked.Error()+": ") {
+		return fmt.Errorf("%w: %s", ErrPanicked, strings.TrimPrefix(msg, ErrPanicked.Error()+": "))
+	}
+
+	return errors.New(msg)
+}
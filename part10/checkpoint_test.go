@@ -0,0 +1,183 @@
+package part10_test
+
+import (
+	"os"
+	. "part10"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint_should_skip_completed_jobs_on_resume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.ckpt")
+
+	value := func(v int) func() interface{} {
+		return func() interface{} {
+			return v
+		}
+	}
+
+	c, err := OpenCheckpoint(path, "nightly-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScheduler(2, 1000*time.Millisecond, WithCheckpoint(c))
+	s.Add(value(1))
+	s.Add(value(2))
+	s.Run()
+	c.Close()
+
+	c, err = OpenCheckpoint(path, "nightly-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if n := c.Completed(); n != 2 {
+		t.Fatalf("Wanted 2 completed jobs, got %v", n)
+	}
+
+	rerun := func() interface{} {
+		t.Errorf("Completed job was run again")
+		return 0
+	}
+
+	s = NewScheduler(2, 1000*time.Millisecond, WithCheckpoint(c))
+	s.Add(rerun)
+	s.Add(rerun)
+	s.Add(value(3))
+
+	actual := s.Run()
+	expected := []Result{
+		Result{Value: 1},
+		Result{Value: 2},
+		Result{Value: 3},
+	}
+
+	if !reflect.DeepEqual(outcomes(actual), expected) {
+		t.Errorf("Wanted %v, got %v", expected, actual)
+	}
+
+	if actual[0].Status != Skipped || actual[1].Status != Skipped || actual[2].Status != Succeeded {
+		t.Errorf("Wanted restored jobs skipped, got %v, %v and %v", actual[0].Status, actual[1].Status, actual[2].Status)
+	}
+
+	if err := s.Err(); err != nil {
+		t.Errorf("Wanted nil, got %v", err)
+	}
+}
+
+func TestCheckpoint_should_keep_runs_apart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.ckpt")
+
+	c, err := OpenCheckpoint(path, "nightly-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScheduler(2, 0, WithCheckpoint(c))
+	s.Add(constant(1))
+	s.Add(constant(2))
+	s.Run()
+
+	s.Add(constant(3))
+	s.Add(constant(4))
+
+	if actual := values(s.Run()); !reflect.DeepEqual(actual, []interface{}{3, 4}) {
+		t.Fatalf("Wanted the second Run to run its own jobs, got %v", actual)
+	}
+	c.Close()
+
+	c, err = OpenCheckpoint(path, "nightly-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s = NewScheduler(2, 0, WithCheckpoint(c))
+	for run := 0; run < 2; run++ {
+		s.Add(constant(0))
+		s.Add(constant(0))
+
+		expected := []interface{}{2*run + 1, 2*run + 2}
+		if actual := values(s.Run()); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Wanted Run %v resumed as %v, got %v", run+1, expected, actual)
+		}
+	}
+}
+
+func TestCheckpoint_should_restore_timeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.ckpt")
+
+	c, err := OpenCheckpoint(path, "nightly-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	s := NewScheduler(1, 10*time.Millisecond, WithCheckpoint(c))
+	s.Add(func() interface{} {
+		<-release
+		return 1
+	})
+	s.Run()
+	c.Close()
+
+	c, err = OpenCheckpoint(path, "nightly-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s = NewScheduler(1, 10*time.Millisecond, WithCheckpoint(c))
+	s.Add(func() interface{} { return 1 })
+
+	if actual := s.Run(); actual[0].Err != Timeout {
+		t.Errorf("Wanted %v, got %v", Timeout, actual[0].Err)
+	}
+}
+
+func TestCheckpoint_should_discard_other_batches_and_torn_lines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.ckpt")
+
+	c, err := OpenCheckpoint(path, "nightly-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScheduler(1, 1000*time.Millisecond, WithCheckpoint(c))
+	s.Add(func() interface{} { return 1 })
+	s.Run()
+	c.Close()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("not a rec")
+	f.Close()
+
+	c, err = OpenCheckpoint(path, "nightly-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.Completed(); n != 1 {
+		t.Errorf("Wanted 1 completed job, got %v", n)
+	}
+	c.Close()
+
+	c, err = OpenCheckpoint(path, "nightly-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if n := c.Completed(); n != 0 {
+		t.Errorf("Wanted 0 completed jobs, got %v", n)
+	}
+}
@@ -0,0 +1,101 @@
+package part10
+
+import (
+	"sync"
+	"time"
+)
+
+// call is a keyed job that is queued or running; followers wait on done and
+// then share result.
+type call struct {
+	done   chan struct{}
+	result Result
+}
+
+type cachedResult struct {
+	result  Result
+	expires time.Time
+}
+
+type flightGroup struct {
+	mu        sync.Mutex
+	calls     map[string]*call
+	ttl       time.Duration
+	cache     map[string]cachedResult
+	nextSweep time.Time
+	clock     Clock
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		calls: make(map[string]*call),
+		cache: make(map[string]cachedResult),
+	}
+}
+
+// WithResultCache keeps successful results of keyed jobs for ttl, so a job
+// submitted with the same key shortly after another finished reuses its Result.
+func WithResultCache(ttl time.Duration) Option {
+	return func(s *Scheduler) {
+		s.flights.ttl = ttl
+	}
+}
+
+// join returns the in-flight call for key, registering a new one when there is
+// none. leader reports whether the caller is responsible for running it.
+func (g *flightGroup) join(key string) (c *call, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.calls[key]; ok {
+		return c, false
+	}
+
+	c = &call{done: make(chan struct{})}
+	g.calls[key] = c
+
+	return c, true
+}
+
+func (g *flightGroup) finish(key string, c *call, result Result) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c.result = result
+	close(c.done)
+	delete(g.calls, key)
+
+	if g.ttl <= 0 || result.Err != nil {
+		return
+	}
+
+	now := g.clock.Now()
+
+	if now.After(g.nextSweep) {
+		for k, entry := range g.cache {
+			if now.After(entry.expires) {
+				delete(g.cache, k)
+			}
+		}
+		g.nextSweep = now.Add(g.ttl)
+	}
+
+	g.cache[key] = cachedResult{result, now.Add(g.ttl)}
+}
+
+func (g *flightGroup) cached(key string) (Result, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	entry, ok := g.cache[key]
+	if !ok {
+		return Result{}, false
+	}
+
+	if g.clock.Now().After(entry.expires) {
+		delete(g.cache, key)
+		return Result{}, false
+	}
+
+	return entry.result, true
+}
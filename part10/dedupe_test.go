@@ -0,0 +1,125 @@
+package part10_test
+
+import (
+	. "part10"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_run_duplicate_keys_once(t *testing.T) {
+	s := NewScheduler(2, 1000*time.Millisecond)
+
+	var calls int32
+	report := func(v int) func() interface{} {
+		return func() interface{} {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(10 * time.Millisecond)
+			return v
+		}
+	}
+
+	s.AddKeyed("report-42", report(42))
+	s.AddKeyed("report-42", report(43))
+	s.AddKeyed("report-7", report(7))
+	s.Add(report(1))
+
+	actual := s.Run()
+	expected := []Result{
+		Result{Value: 42},
+		Result{Value: 42},
+		Result{Value: 7},
+		Result{Value: 1},
+	}
+
+	if !reflect.DeepEqual(outcomes(actual), expected) {
+		t.Errorf("Wanted %v, got %v", expected, actual)
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 3 {
+		t.Errorf("Wanted 3 calls, got %v", c)
+	}
+}
+
+func TestScheduler_should_share_in_flight_keys_across_runs(t *testing.T) {
+	s := NewScheduler(2, 1000*time.Millisecond)
+
+	var calls int32
+	started, release := make(chan struct{}), make(chan struct{})
+
+	s.AddKeyed("report", func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-release
+		return 1
+	})
+
+	var wg sync.WaitGroup
+	var first []Result
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first = s.Run()
+	}()
+
+	<-started
+
+	s.AddKeyed("report", func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		return 2
+	})
+
+	// The second Run dispatches this once it has attached to the in-flight
+	// job
+	attached := make(chan struct{})
+	s.Add(func() interface{} {
+		close(attached)
+		return nil
+	})
+
+	done := make(chan []Result)
+	go func() {
+		done <- s.Run()
+	}()
+
+	<-attached
+	close(release)
+	second := <-done
+	wg.Wait()
+
+	if first[0].Value != 1 || second[0].Value != 1 {
+		t.Errorf("Wanted both runs to share 1, got %v and %v", first[0].Value, second[0].Value)
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Errorf("Wanted 1 call, got %v", c)
+	}
+}
+
+func TestScheduler_should_reuse_cached_results_until_they_expire(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(1, 0, WithResultCache(20*time.Millisecond), WithClock(clock))
+
+	var calls int32
+	report := func() interface{} {
+		return int(atomic.AddInt32(&calls, 1))
+	}
+
+	s.AddKeyed("report", report)
+	s.Run()
+
+	s.AddKeyed("report", report)
+	if actual := s.Run(); actual[0].Value != 1 {
+		t.Errorf("Wanted cached 1, got %v", actual[0].Value)
+	}
+
+	clock.Advance(30 * time.Millisecond)
+
+	s.AddKeyed("report", report)
+	if actual := s.Run(); actual[0].Value != 2 {
+		t.Errorf("Wanted fresh 2, got %v", actual[0].Value)
+	}
+}
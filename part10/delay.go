@@ -0,0 +1,79 @@
+package part10
+
+import (
+	"sync"
+	"time"
+)
+
+// AddAfter schedules w to be dispatched once delay has passed in Run.
+func (s *Scheduler) AddAfter(delay time.Duration, w work) JobID {
+	return s.enqueue(job{w: w, delay: delay})
+}
+
+// WithRetry re-runs a job that failed, timed out or panicked up to retries
+// more times. The n-th retry waits backoff * 2^(n-1); only the last attempt's
+// Result is reported.
+func WithRetry(retries int, backoff time.Duration) Option {
+	return func(s *Scheduler) {
+		s.retries = retries
+		s.backoff = backoff
+	}
+}
+
+// WithClock drives timeouts, retry backoffs and delays from clock instead of
+// the real time.
+func WithClock(clock Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// WithTickResolution sets the granularity of timeouts, backoffs and delays,
+// DefaultTickResolution by default.
+func WithTickResolution(resolution time.Duration) Option {
+	return func(s *Scheduler) {
+		s.resolution = resolution
+	}
+}
+
+// delayQueue collects requests released by wheel timers. The wheel goroutine
+// must never block on Run, so releases are buffered and Run is woken with a
+// non-blocking signal on wake.
+type delayQueue struct {
+	mu       sync.Mutex
+	requests []jobRequest
+	wake     chan struct{}
+}
+
+func newDelayQueue() *delayQueue {
+	return &delayQueue{wake: make(chan struct{}, 1)}
+}
+
+func (q *delayQueue) after(wheel *TimerWheel, d time.Duration, request jobRequest) {
+	wheel.AfterFunc(d, func() {
+		request.queued = wheel.clock.Now()
+		q.push(request)
+	})
+}
+
+// push queues requests for Run straight away.
+func (q *delayQueue) push(requests ...jobRequest) {
+	q.mu.Lock()
+	q.requests = append(q.requests, requests...)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *delayQueue) take() []jobRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	requests := q.requests
+	q.requests = nil
+
+	return requests
+}
@@ -0,0 +1,205 @@
+package part10
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventEnqueued   EventType = "enqueued"
+	EventRejected   EventType = "rejected"
+	EventCancelled  EventType = "cancelled"
+	EventDropped    EventType = "dropped"
+	EventDispatched EventType = "dispatched"
+	EventStarted    EventType = "started"
+	EventTimedOut   EventType = "timed_out"
+	EventPanicked   EventType = "panicked"
+	EventRetried    EventType = "retried"
+	EventCompleted  EventType = "completed"
+	EventStuck      EventType = "stuck"
+	EventReplaced   EventType = "replaced"
+)
+
+// Event is one line of the event log. Rejected and cancelled submissions have
+// no ID; Worker is 0 until the attempt is dispatched, which happens when a
+// worker takes the batch holding it.
+type Event struct {
+	Type    EventType `json:"type"`
+	Time    time.Time `json:"time"`
+	ID      JobID     `json:"id,omitempty"`
+	Attempt int       `json:"attempt,omitempty"`
+	Worker  int       `json:"worker,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// WithEventLog writes an Event per step of every job's life to w as JSON
+// Lines, each line in a single Write. Writes are serialised; the first write
+// error is reported by Err at the end of the Run.
+func WithEventLog(w io.Writer) Option {
+	return func(s *Scheduler) {
+		s.events = &eventLog{w: w}
+	}
+}
+
+// ReadEvents reads an event log back, for instance to replay a problematic
+// Run.
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+
+		events = append(events, event)
+	}
+}
+
+type eventLog struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+func (l *eventLog) emit(kind EventType, id JobID, attempt, worker int, err error) {
+	if l == nil {
+		return
+	}
+
+	event := Event{Type: kind, Time: time.Now(), ID: id, Attempt: attempt, Worker: worker}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.w.Write(append(line, '\n')); err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+func (l *eventLog) writeErr() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// RotatingFile is an append-only file that is rotated before a write would
+// grow it past MaxSize. The current file keeps its path; older ones are
+// renamed path.1, path.2 and so on up to MaxBackups, dropping the oldest.
+// Writes are never split across files.
+type RotatingFile struct {
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+}
+
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{MaxSize: maxSize, MaxBackups: maxBackups, path: path}
+
+	if err := f.open(os.O_APPEND); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *RotatingFile) open(mode int) error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|mode, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size = file, info.Size()
+
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.MaxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// rotate moves the file to the first backup and starts an empty one. When the
+// backups cannot be moved, the file is reopened to keep appending to it.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if err := f.shift(); err != nil {
+		if reopenErr := f.open(os.O_APPEND); reopenErr != nil {
+			return reopenErr
+		}
+
+		return err
+	}
+
+	return f.open(os.O_TRUNC)
+}
+
+func (f *RotatingFile) shift() error {
+	backup := func(n int) string {
+		return f.path + "." + strconv.Itoa(n)
+	}
+
+	if f.MaxBackups > 0 {
+		for n := f.MaxBackups - 1; n >= 1; n-- {
+			if err := os.Rename(backup(n), backup(n+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		if err := os.Rename(f.path, backup(1)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
@@ -0,0 +1,169 @@
+package part10_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	. "part10"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func eventTypes(events []Event, id JobID) string {
+	var types []string
+	for _, event := range events {
+		if event.ID == id {
+			types = append(types, string(event.Type))
+		}
+	}
+
+	return strings.Join(types, " ")
+}
+
+func TestScheduler_should_log_job_events(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewScheduler(2, 20*time.Millisecond, WithEventLog(&buf), WithRetry(1, time.Millisecond))
+
+	release := make(chan struct{})
+	defer close(release)
+
+	succeeded := s.Add(constant(1))
+	panicked := s.Add(func() interface{} { panic("Something bad happened") })
+	timedOut := s.Add(func() interface{} {
+		<-release
+		return nil
+	})
+
+	s.Run()
+
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+
+	events, err := ReadEvents(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[JobID]string{
+		succeeded: "enqueued dispatched started completed",
+		panicked:  "enqueued dispatched started panicked retried dispatched started panicked completed",
+		timedOut:  "enqueued dispatched started timed_out retried dispatched started timed_out completed",
+	}
+
+	for id, types := range expected {
+		if actual := eventTypes(events, id); actual != types {
+			t.Errorf("Wanted %v for %v, got %v", types, id, actual)
+		}
+	}
+
+	last := events[len(events)-1]
+	if last.Type != EventCompleted || last.Attempt != 2 || last.Worker == 0 || last.Error == "" || last.Time.IsZero() {
+		t.Errorf("Wanted the last attempt's failure completed on a worker, got %+v", last)
+	}
+}
+
+func TestScheduler_should_log_refused_submissions(t *testing.T) {
+	for _, c := range []struct {
+		policy   OverflowPolicy
+		expected EventType
+	}{
+		{Block, EventCancelled},
+		{Reject, EventRejected},
+		{DropNewest, EventDropped},
+	} {
+		var buf bytes.Buffer
+		s := NewScheduler(1, 0, WithQueue(1, c.policy), WithEventLog(&buf))
+		s.Add(constant(1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		s.AddContext(ctx, constant(2))
+		cancel()
+
+		events, _ := ReadEvents(&buf)
+		if len(events) != 2 || events[0].Type != EventEnqueued || events[1].Type != c.expected {
+			t.Errorf("Wanted enqueued then %v, got %+v", c.expected, events)
+		}
+	}
+}
+
+func TestRotatingFile_should_rotate_by_size(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	f, err := OpenRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 8; i++ {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(data) != 2*len(line) || strings.Count(string(data), line) != 2 {
+			t.Errorf("Wanted 2 whole lines in %v, got %q", name, data)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Wanted at most 2 backups, got %v", err)
+	}
+
+	f, _ = OpenRotatingFile(path, 100, 2)
+	f.Write([]byte(line))
+	f.Close()
+
+	// The reopened file already holds two lines, so the third rotates it
+	if data, _ := os.ReadFile(path); string(data) != line {
+		t.Errorf("Wanted reopening to count the existing size, got %q", data)
+	}
+}
+
+func TestRotatingFile_should_keep_writing_after_a_failed_rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	// A non-empty directory in the way of the backup fails the rename
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	line := strings.Repeat("x", 7) + "\n"
+	if _, err := f.Write([]byte(line)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte(line)); err == nil {
+		t.Fatal("Wanted the rotation to fail")
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte(line)); err != nil {
+		t.Fatalf("Wanted writes to resume once the backup is free, got %v", err)
+	}
+
+	for _, name := range []string{path, path + ".1"} {
+		if data, _ := os.ReadFile(name); string(data) != line {
+			t.Errorf("Wanted one line in %v, got %q", name, data)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package part10
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TaskFunc is work run by a ForkJoinPool. It may Spawn subtasks on f and Join
+// them before returning.
+type TaskFunc func(f *Fork) interface{}
+
+// Task is a spawned subtask, see Fork.Join.
+type Task struct {
+	fn     TaskFunc
+	inv    *invocation
+	done   bool
+	result Result
+}
+
+// Fork is handed to every running task to spawn and join children.
+type Fork struct {
+	pool *ForkJoinPool
+	inv  *invocation
+}
+
+// ForkJoinPool runs recursive workloads on a bounded set of workers, shared by
+// concurrent Invoke calls. A task joining a child that has not finished runs
+// queued tasks itself, so joins never leave the pool without a free worker.
+// Workers start with the first Invoke and exit once none is running.
+type ForkJoinPool struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      []*Task
+	maxThreads int
+	workers    int
+	invokes    int
+}
+
+// invocation tracks the tasks of a single Invoke on the pool's shared queue.
+type invocation struct {
+	closed bool
+}
+
+func NewForkJoinPool(maxThreads int) *ForkJoinPool {
+	if maxThreads == 0 {
+		maxThreads, _ = DefaultWorkers()
+	}
+
+	p := &ForkJoinPool{maxThreads: maxThreads}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p
+}
+
+// Invoke runs fn and everything it spawns, returning once fn has finished.
+// Panics are reported like Scheduler.Run reports them. Tasks spawned but never
+// joined are dropped with fn; joining one afterwards returns an empty Result.
+func (p *ForkJoinPool) Invoke(fn TaskFunc) Result {
+	inv := &invocation{}
+
+	p.mu.Lock()
+	p.invokes++
+	for ; p.workers < p.maxThreads; p.workers++ {
+		go p.work()
+	}
+	p.mu.Unlock()
+
+	root := (&Fork{p, inv}).Spawn(fn)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !root.done {
+		p.cond.Wait()
+	}
+
+	inv.closed = true
+	p.drop(inv)
+	p.invokes--
+	p.cond.Broadcast()
+
+	return root.result
+}
+
+// drop takes the tasks of inv off the queue, finishing them unrun.
+func (p *ForkJoinPool) drop(inv *invocation) {
+	kept := p.queue[:0]
+
+	for _, t := range p.queue {
+		if t.inv == inv {
+			t.done = true
+		} else {
+			kept = append(kept, t)
+		}
+	}
+
+	for i := len(kept); i < len(p.queue); i++ {
+		p.queue[i] = nil
+	}
+	p.queue = kept
+}
+
+func (p *ForkJoinPool) work() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		for len(p.queue) == 0 && p.invokes > 0 {
+			p.cond.Wait()
+		}
+
+		if len(p.queue) == 0 {
+			p.workers--
+			return
+		}
+
+		t := p.pop()
+		p.mu.Unlock()
+		p.run(t)
+		p.mu.Lock()
+	}
+}
+
+// pop takes the most recently spawned task, keeping recursion depth-first.
+func (p *ForkJoinPool) pop() *Task {
+	t := p.queue[len(p.queue)-1]
+	p.queue[len(p.queue)-1] = nil
+	p.queue = p.queue[:len(p.queue)-1]
+
+	return t
+}
+
+func (p *ForkJoinPool) run(t *Task) {
+	result := func() (result Result) {
+		defer func() {
+			if err := recover(); err != nil {
+				result = Result{Value: 0, Err: fmt.Errorf("%w: %v", ErrPanicked, err)}
+			}
+		}()
+
+		return Result{Value: t.fn(&Fork{p, t.inv})}
+	}()
+
+	p.mu.Lock()
+	t.result, t.done = result, true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// Spawn queues fn to run on any worker of the pool.
+func (f *Fork) Spawn(fn TaskFunc) *Task {
+	t := &Task{fn: fn, inv: f.inv}
+	p := f.pool
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if f.inv.closed {
+		t.done = true
+		return t
+	}
+
+	p.queue = append(p.queue, t)
+	p.cond.Broadcast()
+
+	return t
+}
+
+// Join waits for t, running queued tasks on the calling goroutine meanwhile.
+func (f *Fork) Join(t *Task) Result {
+	p := f.pool
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !t.done {
+		if len(p.queue) == 0 {
+			p.cond.Wait()
+			continue
+		}
+
+		next := p.pop()
+		p.mu.Unlock()
+		p.run(next)
+		p.mu.Lock()
+	}
+
+	return t.result
+}
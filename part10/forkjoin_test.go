@@ -0,0 +1,239 @@
+package part10_test
+
+import (
+	"errors"
+	. "part10"
+	"part4"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+
+	return fib(n-1) + fib(n-2)
+}
+
+func forkFib(n, cutoff int) TaskFunc {
+	return func(f *Fork) interface{} {
+		if n <= cutoff {
+			return fib(n)
+		}
+
+		left := f.Spawn(forkFib(n-1, cutoff))
+		right := f.Spawn(forkFib(n-2, cutoff))
+
+		return f.Join(left).Value.(int) + f.Join(right).Value.(int)
+	}
+}
+
+func TestForkJoinPool_should_join_recursive_tasks_on_one_worker(t *testing.T) {
+	p := NewForkJoinPool(1)
+
+	done := make(chan Result)
+	go func() {
+		done <- p.Invoke(forkFib(20, 5))
+	}()
+
+	select {
+	case result := <-done:
+		if result.Value != 6765 || result.Err != nil {
+			t.Errorf("Wanted 6765, got %v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Join deadlocked the pool")
+	}
+}
+
+func mergeSort(in []int) TaskFunc {
+	return func(f *Fork) interface{} {
+		if len(in) <= 4 {
+			out := append([]int(nil), in...)
+			sort.Ints(out)
+			return out
+		}
+
+		left := f.Spawn(mergeSort(in[:len(in)/2]))
+		right := f.Spawn(mergeSort(in[len(in)/2:]))
+		a, b := f.Join(left).Value.([]int), f.Join(right).Value.([]int)
+
+		out := make([]int, 0, len(in))
+		for len(a) > 0 && len(b) > 0 {
+			if a[0] <= b[0] {
+				out, a = append(out, a[0]), a[1:]
+			} else {
+				out, b = append(out, b[0]), b[1:]
+			}
+		}
+
+		return append(append(out, a...), b...)
+	}
+}
+
+func TestForkJoinPool_should_divide_and_conquer(t *testing.T) {
+	in := []int{9, 3, 7, 1, 8, 2, 6, 4, 5, 0, 11, 10}
+
+	result := NewForkJoinPool(4).Invoke(mergeSort(in))
+	actual := result.Value.([]int)
+
+	if !sort.IntsAreSorted(actual) || len(actual) != len(in) {
+		t.Errorf("Wanted sorted %v, got %v", in, actual)
+	}
+}
+
+func TestForkJoinPool_should_report_panicking_children(t *testing.T) {
+	result := NewForkJoinPool(2).Invoke(func(f *Fork) interface{} {
+		child := f.Spawn(func(f *Fork) interface{} {
+			panic("Something bad happened")
+		})
+
+		return f.Join(child).Err
+	})
+
+	if err, _ := result.Value.(error); !errors.Is(err, ErrPanicked) {
+		t.Errorf("Wanted %v, got %v", ErrPanicked, result.Value)
+	}
+}
+
+func TestForkJoinPool_should_keep_concurrent_invokes_apart(t *testing.T) {
+	// One worker for each root, which both block
+	p := NewForkJoinPool(2)
+	started, spawned, returned := make(chan struct{}), make(chan struct{}), make(chan struct{})
+
+	go func() {
+		p.Invoke(func(f *Fork) interface{} {
+			close(started)
+			<-spawned
+			return 1
+		})
+		close(returned)
+	}()
+
+	<-started
+
+	// The child is still queued when the first Invoke finishes
+	done := make(chan Result)
+	go func() {
+		done <- p.Invoke(func(f *Fork) interface{} {
+			child := f.Spawn(func(f *Fork) interface{} {
+				<-returned
+				return 2
+			})
+			close(spawned)
+			<-returned
+
+			return f.Join(child).Value
+		})
+	}()
+
+	select {
+	case result := <-done:
+		if result.Value != 2 || result.Err != nil {
+			t.Errorf("Wanted 2, got %v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("One Invoke finishing stopped another")
+	}
+}
+
+func TestForkJoinPool_should_share_its_workers_between_invokes(t *testing.T) {
+	p := NewForkJoinPool(2)
+	var inFlight, maxInFlight int32
+
+	leaf := func(f *Fork) interface{} {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return 1
+	}
+
+	spread := func(f *Fork) interface{} {
+		tasks := make([]*Task, 8)
+		for i := range tasks {
+			tasks[i] = f.Spawn(leaf)
+		}
+
+		sum := 0
+		for _, task := range tasks {
+			sum += f.Join(task).Value.(int)
+		}
+
+		return sum
+	}
+
+	var invokes sync.WaitGroup
+	results := make([]Result, 2)
+
+	for i := range results {
+		i := i
+		invokes.Add(1)
+		go func() {
+			defer invokes.Done()
+			results[i] = p.Invoke(spread)
+		}()
+	}
+
+	invokes.Wait()
+
+	for _, result := range results {
+		if result.Value != 8 || result.Err != nil {
+			t.Errorf("Wanted 8, got %v", result)
+		}
+	}
+
+	if m := atomic.LoadInt32(&maxInFlight); m > 2 {
+		t.Errorf("Wanted at most 2 tasks running across both invokes, got %v", m)
+	}
+}
+
+var fibResult int
+
+func BenchmarkForkJoinPool_Fib30(b *testing.B) {
+	p := NewForkJoinPool(0)
+
+	for n := 0; n < b.N; n++ {
+		fibResult = p.Invoke(forkFib(30, 15)).Value.(int)
+	}
+}
+
+// The part4 pool cannot recurse, so the leaves of the same split are
+// enumerated up front and scheduled as a flat batch.
+func BenchmarkPart4Scheduler_Fib30(b *testing.B) {
+	var leaves []int
+	var split func(n int)
+	split = func(n int) {
+		if n <= 15 {
+			leaves = append(leaves, n)
+			return
+		}
+
+		split(n - 1)
+		split(n - 2)
+	}
+	split(30)
+
+	for n := 0; n < b.N; n++ {
+		// part4 keeps its jobs after Run, so each round needs its own
+		s := part4.NewScheduler(0)
+		for _, leaf := range leaves {
+			s.Add(func(args ...int) int { return fib(args[0]) }, leaf)
+		}
+
+		fibResult = 0
+		for _, result := range s.Run() {
+			fibResult += result
+		}
+	}
+}
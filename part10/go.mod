@@ -1,3 +1,7 @@
 module part10
 
-go 1.16
+go 1.18
+
+require part4 v0.0.0
+
+replace part4 => ../part4
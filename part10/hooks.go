@@ -0,0 +1,69 @@
+package part10
+
+import "time"
+
+// JobEvent describes a job at one stage of its life. Worker numbers start at
+// 1; Worker and the times are zero until they apply, and Attempt is 0 for
+// results served from a checkpoint, memo or cache.
+type JobEvent struct {
+	ID       JobID
+	Attempt  int
+	Worker   int
+	Enqueued time.Time
+	Started  time.Time
+	Ended    time.Time
+	Result   Result
+}
+
+// Hooks are called at each stage of a job's life. Hooks called on workers run
+// concurrently with each other and must be safe for that. A panicking hook is
+// recovered and ignored, leaving the job and the scheduler unaffected.
+type Hooks struct {
+	// OnEnqueue runs on the goroutine calling Add, once the job is queued.
+	OnEnqueue func(JobEvent)
+	// OnStart runs on the worker goroutine, just before the job.
+	OnStart func(JobEvent)
+	// OnTimeout runs on the worker goroutine once the job's timeout fired.
+	OnTimeout func(JobEvent)
+	// OnPanic runs on the worker goroutine after the job panicked. Panics
+	// after a timeout are not reported.
+	OnPanic func(JobEvent)
+	// OnComplete runs on the goroutine calling Run, once per job with its final
+	// Result, including results from a checkpoint, memo or cache. Calls are
+	// never concurrent within a Run.
+	OnComplete func(JobEvent)
+}
+
+func WithHooks(h Hooks) Option {
+	return func(s *Scheduler) {
+		s.hooks = &h
+	}
+}
+
+func (h *Hooks) call(hook func(JobEvent), event JobEvent) {
+	if hook == nil {
+		return
+	}
+
+	defer func() {
+		recover()
+	}()
+
+	hook(event)
+}
+
+// complete reports j's final completion, setting result to its annotated
+// Result.
+func (s *Scheduler) complete(result *Result, j *job, c *jobCompletion) {
+	annotate(result, j, c)
+
+	s.events.emit(EventCompleted, j.id, c.attempt, c.worker, result.Err)
+
+	if s.tracer != nil {
+		s.tracer.jobSpan(j, c)
+	}
+
+	if s.hooks != nil {
+		s.hooks.call(s.hooks.OnComplete, JobEvent{j.id, c.attempt, c.worker, j.queued, c.start, c.end, *result})
+	}
+}
@@ -0,0 +1,90 @@
+package part10_test
+
+import (
+	"errors"
+	. "part10"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_call_lifecycle_hooks(t *testing.T) {
+	var mu sync.Mutex
+	events := make(map[string][]JobEvent)
+	recordTo := func(name string) func(JobEvent) {
+		return func(e JobEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events[name] = append(events[name], e)
+		}
+	}
+
+	// OnComplete calls are never concurrent, so it needs no lock
+	var completed []JobEvent
+
+	s := NewScheduler(2, 30*time.Millisecond, WithHooks(Hooks{
+		OnEnqueue: recordTo("enqueue"),
+		OnStart: func(e JobEvent) {
+			recordTo("start")(e)
+			panic("Hook failed")
+		},
+		OnTimeout:  recordTo("timeout"),
+		OnPanic:    recordTo("panic"),
+		OnComplete: func(e JobEvent) { completed = append(completed, e) },
+	}))
+
+	release := make(chan struct{})
+	defer close(release)
+
+	ids := []JobID{
+		s.Add(constant(1)),
+		s.Add(func() interface{} { panic("Something bad happened") }),
+		s.Add(func() interface{} {
+			<-release
+			return nil
+		}),
+	}
+
+	actual := s.Run()
+
+	if actual[0].Value != 1 || !errors.Is(actual[1].Err, ErrPanicked) || actual[2].Err != Timeout {
+		t.Fatalf("Wanted hook panics not to affect results, got %v", actual)
+	}
+
+	for name, count := range map[string]int{"enqueue": 3, "start": 3, "timeout": 1, "panic": 1} {
+		if len(events[name]) != count {
+			t.Errorf("Wanted %v %v events, got %v", count, name, events[name])
+		}
+	}
+
+	for i, e := range events["enqueue"] {
+		if e.ID != ids[i] || e.Enqueued.IsZero() {
+			t.Errorf("Wanted enqueue event for %v, got %+v", ids[i], e)
+		}
+	}
+
+	if e := events["timeout"][0]; e.ID != ids[2] || e.Worker == 0 || e.Ended.Sub(e.Started) < 30*time.Millisecond {
+		t.Errorf("Wanted a timeout after 30ms on a worker, got %+v", e)
+	}
+
+	if e := events["panic"][0]; e.ID != ids[1] || !errors.Is(e.Result.Err, ErrPanicked) {
+		t.Errorf("Wanted the panicked job, got %+v", e)
+	}
+
+	if len(completed) != 3 {
+		t.Fatalf("Wanted 3 completions, got %v", completed)
+	}
+
+	for _, e := range completed {
+		index := -1
+		for i, id := range ids {
+			if id == e.ID {
+				index = i
+			}
+		}
+
+		if index < 0 || e.Attempt != 1 || e.Worker == 0 || e.Result != actual[index] {
+			t.Errorf("Wanted a completion matching its Result, got %+v", e)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package part10
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter adapts how many jobs a Scheduler keeps in flight. Run never exceeds
+// the scheduler's maxThreads, whatever the limit.
+type Limiter interface {
+	// Limit returns the current concurrency limit.
+	Limit() int
+	// Observe reports a finished job's latency and whether it timed out.
+	Observe(latency time.Duration, timedOut bool)
+}
+
+// WithLimiter gates dispatch on l, starting maxThreads workers but keeping at
+// most l.Limit() jobs in flight.
+func WithLimiter(l Limiter) Option {
+	return func(s *Scheduler) {
+		s.limiter = l
+	}
+}
+
+// Limit reports the scheduler's current concurrency limit.
+func (s *Scheduler) Limit() int {
+	s.mu.Lock()
+	maxThreads := s.maxThreads
+	s.mu.Unlock()
+
+	if s.limiter == nil {
+		return maxThreads
+	}
+
+	if limit := s.limiter.Limit(); limit < maxThreads {
+		if limit < 1 {
+			return 1
+		}
+
+		return limit
+	}
+
+	return maxThreads
+}
+
+// ewma is an exponentially weighted moving average of latencies.
+type ewma struct {
+	alpha float64
+	value float64
+}
+
+func (e *ewma) add(sample float64) float64 {
+	if e.value == 0 {
+		e.value = sample
+	} else {
+		e.value += e.alpha * (sample - e.value)
+	}
+
+	return e.value
+}
+
+// limitBounds raises min to 1, as a limit of 0 would never dispatch, and max
+// to min.
+func limitBounds(min, max int) (int, int) {
+	if min < 1 {
+		min = 1
+	}
+
+	if max < min {
+		max = min
+	}
+
+	return min, max
+}
+
+func clampLimit(limit float64, min, max int) float64 {
+	return math.Max(float64(min), math.Min(float64(max), limit))
+}
+
+// AIMDLimiter grows the limit by one per limit's worth of steady samples and
+// multiplies it by a backoff when a job times out or its latency exceeds a
+// tolerance times the long-run average.
+type AIMDLimiter struct {
+	mu        sync.Mutex
+	min       int
+	max       int
+	backoff   float64
+	tolerance float64
+	limit     float64
+	successes int
+	baseline  ewma
+}
+
+// NewAIMDLimiter starts at min, raised to at least 1, with a backoff of 0.9 and a tolerance of 2.
+func NewAIMDLimiter(min, max int) *AIMDLimiter {
+	min, max = limitBounds(min, max)
+
+	return &AIMDLimiter{
+		min:       min,
+		max:       max,
+		backoff:   0.9,
+		tolerance: 2,
+		limit:     float64(min),
+		baseline:  ewma{alpha: 0.05},
+	}
+}
+
+// SetBackoff sets the factor applied to the limit on timeouts and latency
+// spikes.
+func (l *AIMDLimiter) SetBackoff(backoff float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.backoff = backoff
+}
+
+// SetTolerance sets how many times the long-run average latency a job may take
+// before the limit backs off.
+func (l *AIMDLimiter) SetTolerance(tolerance float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tolerance = tolerance
+}
+
+func (l *AIMDLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+func (l *AIMDLimiter) Observe(latency time.Duration, timedOut bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	baseline := l.baseline.value
+	if !timedOut {
+		l.baseline.add(float64(latency))
+	}
+
+	if timedOut || (baseline > 0 && float64(latency) > l.tolerance*baseline) {
+		l.limit = clampLimit(l.limit*l.backoff, l.min, l.max)
+		l.successes = 0
+		return
+	}
+
+	if l.successes++; l.successes >= int(l.limit) {
+		l.limit = clampLimit(l.limit+1, l.min, l.max)
+		l.successes = 0
+	}
+}
+
+// GradientLimiter scales the limit by the ratio of long-run to recent latency,
+// shrinking it as queueing inside the downstream raises latency and leaving
+// headroom of sqrt(limit) to probe for more capacity while latency is steady.
+// Timeouts halve the limit.
+type GradientLimiter struct {
+	mu        sync.Mutex
+	min       int
+	max       int
+	tolerance float64
+	smoothing float64
+	limit     float64
+	longTerm  ewma
+	shortTerm ewma
+}
+
+// NewGradientLimiter starts at min, raised to at least 1, with a tolerance of
+// 1.5 and a smoothing of 0.2.
+func NewGradientLimiter(min, max int) *GradientLimiter {
+	min, max = limitBounds(min, max)
+
+	return &GradientLimiter{
+		min:       min,
+		max:       max,
+		tolerance: 1.5,
+		smoothing: 0.2,
+		limit:     float64(min),
+		longTerm:  ewma{alpha: 0.01},
+		shortTerm: ewma{alpha: 0.3},
+	}
+}
+
+// SetTolerance sets how far recent latency may rise above the long-run
+// average before the limit shrinks.
+func (l *GradientLimiter) SetTolerance(tolerance float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tolerance = tolerance
+}
+
+// SetSmoothing sets how much of each new estimate moves the limit, from 0 to 1.
+func (l *GradientLimiter) SetSmoothing(smoothing float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.smoothing = smoothing
+}
+
+func (l *GradientLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+func (l *GradientLimiter) Observe(latency time.Duration, timedOut bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if timedOut {
+		l.limit = clampLimit(l.limit/2, l.min, l.max)
+		return
+	}
+
+	long, short := l.longTerm.add(float64(latency)), l.shortTerm.add(float64(latency))
+	gradient := math.Max(0.5, math.Min(1, l.tolerance*long/short))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+
+	l.limit = clampLimit(l.limit*(1-l.smoothing)+next*l.smoothing, l.min, l.max)
+}
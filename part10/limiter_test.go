@@ -0,0 +1,144 @@
+package part10_test
+
+import (
+	. "part10"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAIMDLimiter_should_grow_while_latency_is_steady(t *testing.T) {
+	l := NewAIMDLimiter(2, 10)
+
+	for i := 0; i < 200; i++ {
+		l.Observe(10*time.Millisecond, false)
+	}
+
+	if limit := l.Limit(); limit != 10 {
+		t.Errorf("Wanted the limit to reach max 10, got %v", limit)
+	}
+
+	for i := 0; i < 100; i++ {
+		l.Observe(time.Second, true)
+	}
+
+	if limit := l.Limit(); limit != 2 {
+		t.Errorf("Wanted timeouts to cut the limit to min 2, got %v", limit)
+	}
+}
+
+func TestAIMDLimiter_should_back_off_when_latency_rises(t *testing.T) {
+	l := NewAIMDLimiter(1, 20)
+
+	for i := 0; i < 200; i++ {
+		l.Observe(10*time.Millisecond, false)
+	}
+	before := l.Limit()
+
+	l.Observe(100*time.Millisecond, false)
+
+	if after := l.Limit(); after >= before {
+		t.Errorf("Wanted the limit to drop below %v, got %v", before, after)
+	}
+}
+
+func TestAIMDLimiter_should_back_off_by_the_set_factor(t *testing.T) {
+	l := NewAIMDLimiter(1, 20)
+	l.SetBackoff(0.5)
+
+	for i := 0; i < 200; i++ {
+		l.Observe(10*time.Millisecond, false)
+	}
+
+	l.Observe(time.Second, true)
+
+	if limit := l.Limit(); limit != 10 {
+		t.Errorf("Wanted a timeout to halve the limit to 10, got %v", limit)
+	}
+}
+
+func TestLimiters_should_keep_at_least_one_job_in_flight(t *testing.T) {
+	for _, l := range []Limiter{NewAIMDLimiter(0, 0), NewGradientLimiter(0, -1), NewAIMDLimiter(3, 2)} {
+		for i := 0; i < 10; i++ {
+			l.Observe(time.Second, true)
+		}
+
+		if limit := l.Limit(); limit < 1 {
+			t.Fatalf("Wanted a limit of at least 1, got %v", limit)
+		}
+
+		s := NewScheduler(2, 0, WithLimiter(l))
+		s.Add(constant(1))
+
+		done := make(chan []Result)
+		go func() {
+			done <- s.Run()
+		}()
+
+		select {
+		case results := <-done:
+			if len(results) != 1 || results[0].Value != 1 {
+				t.Errorf("Wanted [1], got %v", results)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run never dispatched under a limit of 0")
+		}
+	}
+}
+
+func TestGradientLimiter_should_track_latency_gradient(t *testing.T) {
+	l := NewGradientLimiter(1, 50)
+
+	for i := 0; i < 100; i++ {
+		l.Observe(10*time.Millisecond, false)
+	}
+	steady := l.Limit()
+
+	if steady <= 1 {
+		t.Fatalf("Wanted the limit to grow, got %v", steady)
+	}
+
+	for i := 0; i < 20; i++ {
+		l.Observe(100*time.Millisecond, false)
+	}
+
+	if degraded := l.Limit(); degraded >= steady {
+		t.Errorf("Wanted the limit to shrink below %v, got %v", steady, degraded)
+	}
+}
+
+type fixedLimiter int
+
+func (l fixedLimiter) Limit() int                  { return int(l) }
+func (l fixedLimiter) Observe(time.Duration, bool) {}
+
+func TestScheduler_should_keep_in_flight_jobs_under_the_limit(t *testing.T) {
+	s := NewScheduler(8, 1000*time.Millisecond, WithLimiter(fixedLimiter(3)))
+
+	if limit := s.Limit(); limit != 3 {
+		t.Errorf("Wanted limit 3, got %v", limit)
+	}
+
+	var inFlight, maxInFlight int32
+	for i := 0; i < 30; i++ {
+		s.Add(func() interface{} {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				m := atomic.LoadInt32(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			return nil
+		})
+	}
+
+	s.Run()
+
+	if m := atomic.LoadInt32(&maxInFlight); m > 3 {
+		t.Errorf("Wanted at most 3 jobs in flight, got %v", m)
+	}
+}
@@ -0,0 +1,205 @@
+package part10
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+)
+
+var ErrUnregistered = errors.New("memo function not registered")
+
+// Memo caches results of pure int functions, the func(...int) int work of the
+// earlier parts, keyed by a registered name and a hash of the arguments. The
+// least recently used entry is evicted once capacity is reached.
+type Memo struct {
+	mu       sync.Mutex
+	capacity int
+	funcs    map[string]func(...int) int
+	entries  map[string]*list.Element
+	lru      *list.List
+	hits     uint64
+	misses   uint64
+}
+
+type memoEntry struct {
+	key   string
+	args  []int
+	value int
+}
+
+// MemoStats counts calls resolved from the cache or by joining an identical
+// call in flight as hits, and calls that ran as misses.
+type MemoStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// NewMemo creates a Memo holding up to capacity entries. A capacity of 0 or
+// less leaves it unbounded.
+func NewMemo(capacity int) *Memo {
+	return &Memo{
+		capacity: capacity,
+		funcs:    make(map[string]func(...int) int),
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Register makes f available to AddMemoized under name. f must be pure: its
+// result may only depend on its arguments.
+func (m *Memo) Register(name string, f func(...int) int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.funcs[name] = f
+}
+
+func (m *Memo) Stats() MemoStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return MemoStats{m.hits, m.misses, m.lru.Len()}
+}
+
+func WithMemo(m *Memo) Option {
+	return func(s *Scheduler) {
+		s.memo = m
+	}
+}
+
+// AddMemoized schedules the function registered as name on the scheduler's
+// Memo. Calls already cached resolve without occupying a worker and identical
+// calls in flight run once. Unregistered names, or a scheduler without a Memo,
+// yield ErrUnregistered.
+func (s *Scheduler) AddMemoized(name string, args ...int) JobID {
+	c := &memoCall{name, memoKey(name, args), append([]int(nil), args...)}
+
+	return s.enqueue(job{
+		w:    s.memo.work(c),
+		key:  memoFlight(name, args),
+		memo: c,
+		kind: name,
+	})
+}
+
+type memoCall struct {
+	name string
+	key  string
+	args []int
+}
+
+func memoKey(name string, args []int) string {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+
+	for _, arg := range args {
+		binary.LittleEndian.PutUint64(buf, uint64(arg))
+		h.Write(buf)
+	}
+
+	return name + "\x00" + strconv.FormatUint(h.Sum64(), 16)
+}
+
+// memoFlight keys the in-flight call of name with the full args, unlike the
+// hashed cache key, so colliding calls never share a result.
+func memoFlight(name string, args []int) string {
+	key := []byte("\x00memo\x00" + name)
+
+	for _, arg := range args {
+		key = append(key, 0)
+		key = strconv.AppendInt(key, int64(arg), 10)
+	}
+
+	return string(key)
+}
+
+func (m *Memo) work(c *memoCall) work {
+	return func() interface{} {
+		m.mu.Lock()
+		f := m.funcs[c.name]
+		m.mu.Unlock()
+
+		value := f(c.args...)
+		m.put(c.key, c.args, value)
+
+		return value
+	}
+}
+
+// lookup resolves c without running it, either from the cache or with
+// ErrUnregistered. ok is false when c has to run on a worker or join an
+// identical call in flight, which Run counts.
+func (m *Memo) lookup(c *memoCall) (result Result, ok bool) {
+	if m == nil {
+		return Result{Value: 0, Err: ErrUnregistered}, true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, registered := m.funcs[c.name]; !registered {
+		return Result{Value: 0, Err: ErrUnregistered}, true
+	}
+
+	if el, found := m.entries[c.key]; found {
+		entry := el.Value.(*memoEntry)
+
+		if equalArgs(entry.args, c.args) {
+			m.lru.MoveToFront(el)
+			m.hits++
+			return Result{Value: entry.value}, true
+		}
+	}
+
+	return Result{}, false
+}
+
+// count records a call that missed the cache as a hit if it joined an
+// identical call in flight or was served from the scheduler's result cache.
+func (m *Memo) count(hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func (m *Memo) put(key string, args []int, value int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		el.Value = &memoEntry{key, args, value}
+		m.lru.MoveToFront(el)
+		return
+	}
+
+	m.entries[key] = m.lru.PushFront(&memoEntry{key, args, value})
+
+	for m.capacity > 0 && m.lru.Len() > m.capacity {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoEntry).key)
+	}
+}
+
+func equalArgs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,117 @@
+package part10_test
+
+import (
+	. "part10"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemo_should_run_each_function_and_args_pair_once(t *testing.T) {
+	m := NewMemo(16)
+
+	var calls int32
+	m.Register("sum", func(args ...int) (total int) {
+		atomic.AddInt32(&calls, 1)
+		for _, v := range args {
+			total += v
+		}
+
+		return
+	})
+
+	s := NewScheduler(2, 1000*time.Millisecond, WithMemo(m))
+
+	for i := 0; i < 100; i++ {
+		s.AddMemoized("sum", 1, 2, 3)
+	}
+	s.AddMemoized("sum", 2, 3, 4)
+
+	actual := s.Run()
+
+	if la := len(actual); la != 101 {
+		t.Fatalf("Wanted 101 results, got %v", la)
+	}
+
+	for i := 0; i < 100; i++ {
+		if !reflect.DeepEqual(outcome(actual[i]), Result{Value: 6}) {
+			t.Fatalf("Wanted %v at %v, got %v", Result{Value: 6}, i, actual[i])
+		}
+	}
+
+	if !reflect.DeepEqual(outcome(actual[100]), Result{Value: 9}) {
+		t.Errorf("Wanted %v, got %v", Result{Value: 9}, actual[100])
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 2 {
+		t.Errorf("Wanted 2 calls, got %v", c)
+	}
+
+	if stats := m.Stats(); stats != (MemoStats{Hits: 99, Misses: 2, Entries: 2}) {
+		t.Errorf("Wanted 99 duplicates in flight counted as hits, got %+v", stats)
+	}
+
+	s.AddMemoized("sum", 1, 2, 3)
+	s.Run()
+
+	if stats := m.Stats(); stats != (MemoStats{Hits: 100, Misses: 2, Entries: 2}) {
+		t.Errorf("Wanted a cache hit, got %+v", stats)
+	}
+}
+
+func TestMemo_should_evict_least_recently_used(t *testing.T) {
+	m := NewMemo(2)
+	m.Register("double", func(args ...int) int { return args[0] * 2 })
+
+	s := NewScheduler(1, 1000*time.Millisecond, WithMemo(m))
+
+	// 1 is touched after 2, which leaves 2 the least recently used as 3 comes
+	// in
+	for _, arg := range []int{1, 2, 1, 3} {
+		s.AddMemoized("double", arg)
+		s.Run()
+	}
+
+	if stats := m.Stats(); stats != (MemoStats{Hits: 1, Misses: 3, Entries: 2}) {
+		t.Fatalf("Wanted 2 entries after 1 hit, got %+v", stats)
+	}
+
+	s.AddMemoized("double", 1)
+	s.Run()
+
+	if hits := m.Stats().Hits; hits != 2 {
+		t.Errorf("Wanted the recently touched 1 to hit, got %v hits", hits)
+	}
+
+	s.AddMemoized("double", 2)
+	s.Run()
+
+	if misses := m.Stats().Misses; misses != 4 {
+		t.Errorf("Wanted the evicted 2 to miss, got %v misses", misses)
+	}
+}
+
+func TestMemo_should_be_unbounded_without_a_capacity(t *testing.T) {
+	m := NewMemo(0)
+	m.Register("double", func(args ...int) int { return args[0] * 2 })
+
+	s := NewScheduler(1, 1000*time.Millisecond, WithMemo(m))
+	for i := 0; i < 10; i++ {
+		s.AddMemoized("double", i)
+	}
+	s.Run()
+
+	if entries := m.Stats().Entries; entries != 10 {
+		t.Errorf("Wanted 10 entries, got %v", entries)
+	}
+}
+
+func TestMemo_should_report_unregistered_functions(t *testing.T) {
+	s := NewScheduler(1, 1000*time.Millisecond, WithMemo(NewMemo(2)))
+	s.AddMemoized("missing", 1)
+
+	if actual := s.Run(); actual[0].Err != ErrUnregistered {
+		t.Errorf("Wanted %v, got %v", ErrUnregistered, actual[0].Err)
+	}
+}
@@ -0,0 +1,261 @@
+package part10
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// metricBuckets are the upper bounds of the queue wait and execution time
+// histograms, from 100µs to 10s.
+var metricBuckets = [...]time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Metrics is a point-in-time copy of a scheduler's metrics. Completed counts
+// the final results of jobs that ran on a worker, by Status; cached, memoized
+// and deduplicated results are not counted.
+type Metrics struct {
+	Submitted uint64
+	Retried   uint64
+	Completed map[Status]uint64
+	Queued    int64
+	Running   int64
+	QueueWait Histogram
+	Execution Histogram
+}
+
+// Histogram holds cumulative counts per upper bound, like Prometheus.
+type Histogram struct {
+	Buckets []Bucket
+	Count   uint64
+	Sum     time.Duration
+}
+
+type Bucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// metrics is updated lock-free by Add, Run and the workers. Workers gather
+// the running gauge and histograms of a batch in batchMetrics and publish them
+// once per batch.
+type metrics struct {
+	queued    int64
+	running   int64
+	submitted uint64
+	retried   uint64
+	completed [Expired + 1]uint64
+	queueWait histogram
+	execution histogram
+}
+
+type histogram struct {
+	sum     int64
+	count   uint64
+	buckets [len(metricBuckets)]uint64
+}
+
+// observe adds d to a histogram owned by a single worker.
+func (h *histogram) observe(d time.Duration) {
+	for i, bound := range metricBuckets {
+		if d <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+
+	h.sum += int64(d)
+	h.count++
+}
+
+// merge adds the observations of a worker's histogram to the shared h.
+func (h *histogram) merge(from *histogram) {
+	if from.count == 0 {
+		return
+	}
+
+	for i, n := range from.buckets {
+		if n > 0 {
+			atomic.AddUint64(&h.buckets[i], n)
+		}
+	}
+
+	atomic.AddInt64(&h.sum, from.sum)
+	atomic.AddUint64(&h.count, from.count)
+}
+
+func (h *histogram) snapshot() Histogram {
+	snapshot := Histogram{
+		Buckets: make([]Bucket, len(metricBuckets)),
+		Count:   atomic.LoadUint64(&h.count),
+		Sum:     time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+
+	var cumulative uint64
+	for i, bound := range metricBuckets {
+		cumulative += atomic.LoadUint64(&h.buckets[i])
+		snapshot.Buckets[i] = Bucket{bound, cumulative}
+	}
+
+	return snapshot
+}
+
+func (m *metrics) submit() {
+	atomic.AddUint64(&m.submitted, 1)
+	atomic.AddInt64(&m.queued, 1)
+}
+
+func (m *metrics) retry() {
+	atomic.AddUint64(&m.retried, 1)
+	atomic.AddInt64(&m.queued, 1)
+}
+
+// unqueue removes n jobs that left the queue without running.
+func (m *metrics) unqueue(n int) {
+	if m != nil {
+		atomic.AddInt64(&m.queued, -int64(n))
+	}
+}
+
+// batchMetrics is what a worker has observed in its current batch. The
+// worker counts as running from its first job to the end of the batch.
+type batchMetrics struct {
+	running   bool
+	queueWait histogram
+	execution histogram
+}
+
+func (m *metrics) start(b *batchMetrics, queued, start time.Time) {
+	if m == nil {
+		return
+	}
+
+	atomic.AddInt64(&m.queued, -1)
+
+	if !b.running {
+		atomic.AddInt64(&m.running, 1)
+		b.running = true
+	}
+
+	b.queueWait.observe(start.Sub(queued))
+}
+
+func (m *metrics) finish(b *batchMetrics, start, end time.Time) {
+	if m != nil {
+		b.execution.observe(end.Sub(start))
+	}
+}
+
+// flush publishes b once its batch is done and resets it for the next one.
+func (m *metrics) flush(b *batchMetrics) {
+	if m == nil {
+		return
+	}
+
+	if b.running {
+		atomic.AddInt64(&m.running, -1)
+	}
+
+	m.queueWait.merge(&b.queueWait)
+	m.execution.merge(&b.execution)
+	*b = batchMetrics{}
+}
+
+func (m *metrics) complete(result *Result) {
+	atomic.AddUint64(&m.completed[statusOf(result)], 1)
+}
+
+// MetricsSnapshot returns the scheduler's current metrics.
+func (s *Scheduler) MetricsSnapshot() Metrics {
+	m := s.metrics
+	snapshot := Metrics{
+		Submitted: atomic.LoadUint64(&m.submitted),
+		Retried:   atomic.LoadUint64(&m.retried),
+		Completed: make(map[Status]uint64),
+		Queued:    atomic.LoadInt64(&m.queued),
+		Running:   atomic.LoadInt64(&m.running),
+		QueueWait: m.queueWait.snapshot(),
+		Execution: m.execution.snapshot(),
+	}
+
+	for status := Succeeded; status <= Expired; status++ {
+		snapshot.Completed[status] = atomic.LoadUint64(&m.completed[status])
+	}
+
+	return snapshot
+}
+
+// MetricsHandler serves the scheduler's metrics in the Prometheus text
+// exposition format.
+func (s *Scheduler) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.MetricsSnapshot().WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes m in the Prometheus text exposition format, with
+// durations in seconds.
+func (m Metrics) WritePrometheus(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	header := func(name, kind, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	header("part10_jobs_submitted_total", "counter", "Jobs accepted by the scheduler.")
+	fmt.Fprintf(b, "part10_jobs_submitted_total %d\n", m.Submitted)
+
+	header("part10_jobs_retried_total", "counter", "Failed attempts queued again.")
+	fmt.Fprintf(b, "part10_jobs_retried_total %d\n", m.Retried)
+
+	header("part10_jobs_completed_total", "counter", "Jobs run to a final result, by status.")
+	for status := Succeeded; status <= Expired; status++ {
+		fmt.Fprintf(b, "part10_jobs_completed_total{status=%q} %d\n", status, m.Completed[status])
+	}
+
+	header("part10_jobs_queued", "gauge", "Jobs waiting to start.")
+	fmt.Fprintf(b, "part10_jobs_queued %d\n", m.Queued)
+
+	header("part10_jobs_running", "gauge", "Jobs running on a worker.")
+	fmt.Fprintf(b, "part10_jobs_running %d\n", m.Running)
+
+	writeHistogram := func(name, help string, h Histogram) {
+		header(name, "histogram", help)
+		for _, bucket := range h.Buckets {
+			fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", name, seconds(bucket.UpperBound), bucket.Count)
+		}
+		fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.Count)
+		fmt.Fprintf(b, "%s_sum %s\n", name, seconds(h.Sum))
+		fmt.Fprintf(b, "%s_count %d\n", name, h.Count)
+	}
+
+	writeHistogram("part10_job_queue_wait_seconds", "Time from submission to start.", m.QueueWait)
+	writeHistogram("part10_job_execution_seconds", "Time from start to result.", m.Execution)
+
+	return b.Flush()
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
@@ -0,0 +1,85 @@
+package part10_test
+
+import (
+	"net/http/httptest"
+	. "part10"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_collect_metrics(t *testing.T) {
+	s := NewScheduler(2, 50*time.Millisecond)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	s.Add(constant(1))
+	s.Add(constant(2))
+	s.Add(constant(3))
+	s.Add(func() interface{} { panic("Something bad happened") })
+	s.Add(func() interface{} {
+		<-release
+		return nil
+	})
+
+	s.Run()
+
+	m := s.MetricsSnapshot()
+
+	if m.Submitted != 5 || m.Queued != 0 || m.Running != 0 {
+		t.Errorf("Wanted 5 submitted and none queued or running, got %+v", m)
+	}
+
+	expected := map[Status]uint64{Succeeded: 3, Failed: 0, TimedOut: 1, Panicked: 1}
+	for status, count := range expected {
+		if m.Completed[status] != count {
+			t.Errorf("Wanted %v %v, got %v", count, status, m.Completed[status])
+		}
+	}
+
+	for _, h := range []Histogram{m.QueueWait, m.Execution} {
+		if h.Count != 5 {
+			t.Errorf("Wanted 5 observations, got %v", h.Count)
+		}
+
+		if last := h.Buckets[len(h.Buckets)-1]; last.UpperBound != 10*time.Second || last.Count != 5 {
+			t.Errorf("Wanted every observation under 10s, got %+v", last)
+		}
+	}
+
+	if m.Execution.Sum < 50*time.Millisecond {
+		t.Errorf("Wanted the timed out job to count towards execution time, got %v", m.Execution.Sum)
+	}
+}
+
+func TestScheduler_should_serve_prometheus_metrics(t *testing.T) {
+	s := NewScheduler(1, 0)
+	s.Add(constant(1))
+	s.Run()
+
+	recorder := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Wanted the Prometheus text format, got %v", contentType)
+	}
+
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE part10_jobs_submitted_total counter",
+		"part10_jobs_submitted_total 1",
+		`part10_jobs_completed_total{status="succeeded"} 1`,
+		`part10_jobs_completed_total{status="timed_out"} 0`,
+		"# TYPE part10_jobs_queued gauge",
+		"part10_jobs_running 0",
+		"# TYPE part10_job_queue_wait_seconds histogram",
+		`part10_job_execution_seconds_bucket{le="0.0001"} `,
+		`part10_job_execution_seconds_bucket{le="+Inf"} 1`,
+		"part10_job_execution_seconds_count 1",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Wanted %q in\n%v", line, body)
+		}
+	}
+}
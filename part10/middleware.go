@@ -0,0 +1,116 @@
+package part10
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Call identifies the job attempt passing through a Handler.
+type Call struct {
+	ID      JobID
+	Attempt int
+	Worker  int
+}
+
+// Handler runs a job attempt. The innermost Handler calls the job itself.
+type Handler func(ctx context.Context, call Call) Result
+
+// Middleware wraps a Handler, running code around next or replacing its
+// Result.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware wraps every job in mws. The first middleware is outermost;
+// scheduler middleware always wraps per-job middleware. Middleware runs on the
+// goroutine running the job, so with a timeout it can outlive the attempt.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(s *Scheduler) {
+		s.middleware = append(s.middleware, mws...)
+	}
+}
+
+// AddWithMiddleware schedules w wrapped in mws, inside the scheduler's
+// middleware, with the first of mws outermost.
+func (s *Scheduler) AddWithMiddleware(w work, mws ...Middleware) JobID {
+	return s.enqueue(job{w: w, middleware: mws})
+}
+
+// chain builds the Handler running j inside the scheduler's middleware and
+// then its own.
+func chain(scheduler []Middleware, j job) Handler {
+	h := Handler(func(context.Context, Call) Result {
+		return Result{Value: j.w()}
+	})
+
+	for i := len(j.middleware) - 1; i >= 0; i-- {
+		h = j.middleware[i](h)
+	}
+
+	for i := len(scheduler) - 1; i >= 0; i-- {
+		h = scheduler[i](h)
+	}
+
+	return h
+}
+
+// Logging logs every attempt's outcome and duration to logger, or the standard
+// logger when nil. Panics pass through unlogged unless Recovery runs inside it.
+func Logging(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call Call) Result {
+			start := time.Now()
+			result := next(ctx, call)
+
+			if result.Err != nil {
+				logger.Printf("job %v attempt %v on worker %v failed after %v: %v", call.ID, call.Attempt, call.Worker, time.Since(start), result.Err)
+			} else {
+				logger.Printf("job %v attempt %v on worker %v succeeded after %v", call.ID, call.Attempt, call.Worker, time.Since(start))
+			}
+
+			return result
+		}
+	}
+}
+
+// Timing reports how long every attempt took to observe, including attempts
+// that panic.
+func Timing(observe func(call Call, elapsed time.Duration)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call Call) Result {
+			start := time.Now()
+			defer func() {
+				observe(call, time.Since(start))
+			}()
+
+			return next(ctx, call)
+		}
+	}
+}
+
+// Recovery turns a panic inside it into a Result with the error translate
+// returns, or an ErrPanicked error when translate is nil. Panics escaping all
+// middleware still become ErrPanicked results.
+func Recovery(translate func(recovered interface{}) error) Middleware {
+	if translate == nil {
+		translate = func(recovered interface{}) error {
+			return fmt.Errorf("%w: %v", ErrPanicked, recovered)
+		}
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call Call) (result Result) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					result = Result{Value: 0, Err: translate(recovered)}
+				}
+			}()
+
+			return next(ctx, call)
+		}
+	}
+}
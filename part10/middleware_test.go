@@ -0,0 +1,95 @@
+package part10_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	. "part10"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_run_middleware_in_order(t *testing.T) {
+	var trace []string
+	tracing := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call Call) Result {
+				trace = append(trace, name+">")
+				result := next(ctx, call)
+				trace = append(trace, "<"+name)
+				return result
+			}
+		}
+	}
+
+	s := NewScheduler(1, 0, WithMiddleware(tracing("a"), tracing("b")))
+	s.AddWithMiddleware(func() interface{} {
+		trace = append(trace, "job")
+		return 1
+	}, tracing("c"), tracing("d"))
+
+	if actual := s.Run(); actual[0].Value != 1 {
+		t.Errorf("Wanted 1, got %v", actual[0])
+	}
+
+	if expected := "a> b> c> d> job <d <c <b <a"; strings.Join(trace, " ") != expected {
+		t.Errorf("Wanted %v, got %v", expected, trace)
+	}
+}
+
+func TestScheduler_should_translate_panics_in_middleware(t *testing.T) {
+	errBroken := errors.New("Broken")
+	s := NewScheduler(1, time.Second, WithMiddleware(Recovery(func(recovered interface{}) error {
+		return errBroken
+	})))
+
+	s.Add(func() interface{} { panic("Something bad happened") })
+	s.AddWithMiddleware(func() interface{} { panic("Something bad happened") }, Recovery(nil))
+
+	actual := s.Run()
+
+	if actual[0].Err != errBroken {
+		t.Errorf("Wanted %v, got %v", errBroken, actual[0].Err)
+	}
+
+	if !errors.Is(actual[1].Err, ErrPanicked) {
+		t.Errorf("Wanted the inner Recovery to win with %v, got %v", ErrPanicked, actual[1].Err)
+	}
+}
+
+func TestScheduler_should_log_and_time_jobs(t *testing.T) {
+	var buf bytes.Buffer
+	var calls []Call
+	var elapsed []time.Duration
+
+	s := NewScheduler(1, 0, WithMiddleware(
+		Logging(log.New(&buf, "", 0)),
+		Timing(func(call Call, d time.Duration) {
+			calls = append(calls, call)
+			elapsed = append(elapsed, d)
+		}),
+	))
+
+	id := s.Add(func() interface{} {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	s.Add(func() interface{} { panic("Something bad happened") })
+
+	s.Run()
+
+	if len(calls) != 2 || calls[0].ID != id || calls[0].Attempt != 1 || calls[0].Worker != 1 {
+		t.Fatalf("Wanted both attempts timed, got %+v", calls)
+	}
+
+	if elapsed[0] < 5*time.Millisecond {
+		t.Errorf("Wanted at least 5ms, got %v", elapsed[0])
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], string(id)) || !strings.Contains(lines[0], "succeeded") {
+		t.Errorf("Wanted one success logged for %v before the panic escaped, got %q", id, lines)
+	}
+}
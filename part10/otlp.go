@@ -0,0 +1,177 @@
+package part10
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// OTLPFileExporter writes each export as an OTLP/JSON
+// ExportTraceServiceRequest on its own line, the format of the OpenTelemetry
+// Collector's file exporter.
+type OTLPFileExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewOTLPFileExporter(w io.Writer) *OTLPFileExporter {
+	return &OTLPFileExporter{w: w}
+}
+
+func (e *OTLPFileExporter) ExportSpans(spans []Span) error {
+	data, err := MarshalOTLP(spans)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+// OTLPHTTPExporter posts OTLP/JSON to a collector's traces endpoint, such as
+// http://localhost:4318/v1/traces. A nil Client uses http.DefaultClient.
+type OTLPHTTPExporter struct {
+	URL    string
+	Client *http.Client
+}
+
+func (e *OTLPHTTPExporter) ExportSpans(spans []Span) error {
+	data, err := MarshalOTLP(spans)
+	if err != nil {
+		return err
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(e.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP export to %v: %v", e.URL, resp.Status)
+	}
+
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+// MarshalOTLP encodes spans as an OTLP/JSON ExportTraceServiceRequest from the
+// "part10" service.
+func MarshalOTLP(spans []Span) ([]byte, error) {
+	encoded := make([]otlpSpan, len(spans))
+
+	for i, span := range spans {
+		encoded[i] = otlpSpan{
+			TraceID:           hex.EncodeToString(span.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.SpanID[:]),
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+
+		if span.ParentID != ([8]byte{}) {
+			encoded[i].ParentSpanID = hex.EncodeToString(span.ParentID[:])
+		}
+
+		for _, attribute := range span.Attributes {
+			encoded[i].Attributes = append(encoded[i].Attributes, otlpAttributeOf(attribute.Key, attribute.Value))
+		}
+
+		if span.Err != nil {
+			encoded[i].Status = otlpStatus{otlpStatusError, span.Err.Error()}
+		}
+	}
+
+	return json.Marshal(otlpRequest{[]otlpResourceSpans{{
+		Resource:   otlpResource{[]otlpAttribute{otlpAttributeOf("service.name", "part10")}},
+		ScopeSpans: []otlpScopeSpans{{otlpScope{"part10"}, encoded}},
+	}}})
+}
+
+func otlpAttributeOf(key string, value interface{}) otlpAttribute {
+	var v otlpValue
+
+	switch value := value.(type) {
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case string:
+		v.StringValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+
+	return otlpAttribute{key, v}
+}
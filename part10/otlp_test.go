@@ -0,0 +1,140 @@
+package part10_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	. "part10"
+	"testing"
+	"time"
+)
+
+type otlpTrace struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []struct {
+				Key   string
+				Value map[string]string
+			}
+		}
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID           string
+				SpanID            string
+				ParentSpanID      string
+				Name              string
+				StartTimeUnixNano string
+				Attributes        []struct {
+					Key   string
+					Value map[string]string
+				}
+				Status struct {
+					Code    int
+					Message string
+				}
+			}
+		}
+	}
+}
+
+func testSpans() []Span {
+	return []Span{{
+		TraceID:    [16]byte{0x4b, 0xf9},
+		SpanID:     [8]byte{1},
+		ParentID:   [8]byte{2},
+		Name:       "part10.execute",
+		Start:      time.Unix(1, 5),
+		End:        time.Unix(2, 0),
+		Attributes: []Attribute{{"job.id", "a-1"}, {"job.attempt", 2}},
+		Err:        errors.New("Broken"),
+	}}
+}
+
+func checkOTLP(t *testing.T, data []byte) {
+	t.Helper()
+
+	var trace otlpTrace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("Wanted OTLP/JSON, got %v: %s", err, data)
+	}
+
+	resource := trace.ResourceSpans[0]
+	if attribute := resource.Resource.Attributes[0]; attribute.Key != "service.name" || attribute.Value["stringValue"] != "part10" {
+		t.Errorf("Wanted the part10 service, got %+v", attribute)
+	}
+
+	span := resource.ScopeSpans[0].Spans[0]
+	if span.TraceID != "4bf90000000000000000000000000000" || span.SpanID != "0100000000000000" || span.ParentSpanID != "0200000000000000" {
+		t.Errorf("Wanted hex IDs, got %+v", span)
+	}
+
+	if span.Name != "part10.execute" || span.StartTimeUnixNano != "1000000005" {
+		t.Errorf("Wanted the span's name and start, got %+v", span)
+	}
+
+	if span.Attributes[1].Key != "job.attempt" || span.Attributes[1].Value["intValue"] != "2" {
+		t.Errorf("Wanted an int attribute, got %+v", span.Attributes)
+	}
+
+	if span.Status.Code != 2 || span.Status.Message != "Broken" {
+		t.Errorf("Wanted an error status, got %+v", span.Status)
+	}
+}
+
+func TestOTLPFileExporter_should_write_a_line_per_export(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewOTLPFileExporter(&buf)
+
+	if err := e.ExportSpans(testSpans()); err != nil {
+		t.Fatal(err)
+	}
+	e.ExportSpans(testSpans())
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Wanted 2 lines, got %q", buf.String())
+	}
+
+	checkOTLP(t, lines[0])
+}
+
+func TestOTLPHTTPExporter_should_post_to_the_collector(t *testing.T) {
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "Unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer collector.Close()
+
+	s := NewScheduler(1, 0, WithTracing(&OTLPHTTPExporter{URL: collector.URL + "/v1/traces"}))
+	s.Add(constant(1))
+	s.Run()
+
+	if s.Err() != nil {
+		t.Fatalf("Wanted the export to succeed, got %v", s.Err())
+	}
+
+	var trace otlpTrace
+	if err := json.Unmarshal(<-received, &trace); err != nil || len(trace.ResourceSpans[0].ScopeSpans[0].Spans) != 3 {
+		t.Errorf("Wanted 3 spans, got %+v (%v)", trace, err)
+	}
+
+	if err := (&OTLPHTTPExporter{URL: collector.URL + "/wrong"}).ExportSpans(testSpans()); err == nil {
+		t.Errorf("Wanted an error from a rejected export")
+	}
+
+	exporter := &OTLPHTTPExporter{URL: collector.URL + "/v1/traces", Client: collector.Client()}
+	if err := exporter.ExportSpans(testSpans()); err != nil {
+		t.Fatal(err)
+	}
+
+	checkOTLP(t, <-received)
+}
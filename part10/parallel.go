@@ -0,0 +1,194 @@
+package part10
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrEmptyInput = errors.New("reduce of empty input")
+
+// ParallelOptions configure the Scheduler behind Map, ForEach and Reduce.
+// Options are applied to it as they are by NewScheduler. A call runs on
+// Scheduler instead when it is set, which nothing else may add jobs to or run
+// while the call is in progress.
+type ParallelOptions struct {
+	MaxThreads int
+	Timeout    time.Duration
+	Options    []Option
+	Scheduler  *Scheduler
+}
+
+// ElementError is the failure of the element at Index.
+type ElementError struct {
+	Index int
+	Err   error
+}
+
+func (e ElementError) Error() string {
+	return fmt.Sprintf("element %d: %v", e.Index, e.Err)
+}
+
+func (e ElementError) Unwrap() error {
+	return e.Err
+}
+
+// ElementErrors collects every failed element of a parallel call in index
+// order.
+type ElementErrors []ElementError
+
+func (e ElementErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	return fmt.Sprintf("%d elements failed, first %v", len(e), e[0])
+}
+
+// Is reports whether any element's error matches target. errors.Is only
+// follows Unwrap() []error from Go 1.20.
+func (e ElementErrors) Is(target error) bool {
+	for i := range e {
+		if errors.Is(e[i], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first element's error that matches target.
+func (e ElementErrors) As(target interface{}) bool {
+	for i := range e {
+		if errors.As(e[i], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e ElementErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i := range e {
+		errs[i] = e[i]
+	}
+
+	return errs
+}
+
+type elementOutput[B any] struct {
+	value B
+	err   error
+}
+
+// Map applies f to every element of in on a Scheduler and returns the outputs
+// in input order. Elements that fail, time out or panic keep B's zero value
+// and are reported in the returned ElementErrors. Elements not yet started
+// when ctx is done fail with ctx.Err(), and the context f gets is cancelled
+// once its element times out.
+func Map[A, B any](ctx context.Context, in []A, f func(context.Context, A) (B, error), opts ParallelOptions) ([]B, error) {
+	return mapOn(ctx, opts.scheduler(), in, f)
+}
+
+func (opts ParallelOptions) scheduler() *Scheduler {
+	if opts.Scheduler != nil {
+		return opts.Scheduler
+	}
+
+	return NewScheduler(opts.MaxThreads, opts.Timeout, opts.Options...)
+}
+
+// mapOn runs Map on s, which Reduce keeps for all of its rounds.
+func mapOn[A, B any](ctx context.Context, s *Scheduler, in []A, f func(context.Context, A) (B, error)) ([]B, error) {
+	cancels := make([]context.CancelFunc, len(in))
+
+	for i, a := range in {
+		a := a
+		elementCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+
+		s.enqueue(job{w: func() interface{} {
+			var out elementOutput[B]
+
+			if out.err = elementCtx.Err(); out.err == nil {
+				out.value, out.err = f(elementCtx, a)
+			}
+
+			return out
+		}, expire: cancel})
+	}
+
+	results := s.Run()
+	for _, cancel := range cancels {
+		cancel()
+	}
+
+	values := make([]B, len(in))
+	var errs ElementErrors
+
+	for i, result := range results {
+		err := result.Err
+
+		if err == nil {
+			out := result.Value.(elementOutput[B])
+			values[i], err = out.value, out.err
+		}
+
+		if err != nil {
+			errs = append(errs, ElementError{i, err})
+		}
+	}
+
+	if errs != nil {
+		return values, errs
+	}
+
+	return values, nil
+}
+
+// ForEach calls f for every element of in on a Scheduler.
+func ForEach[A any](ctx context.Context, in []A, f func(context.Context, A) error, opts ParallelOptions) error {
+	_, err := Map(ctx, in, func(ctx context.Context, a A) (struct{}, error) {
+		return struct{}{}, f(ctx, a)
+	}, opts)
+
+	return err
+}
+
+// Reduce folds in with the associative combine as a tree: each round combines
+// adjacent pairs in parallel, halving the input until one value remains. A
+// failing combination stops the reduction; the ElementErrors index refers to
+// the pair's position in that round.
+func Reduce[A any](ctx context.Context, in []A, combine func(A, A) A, opts ParallelOptions) (A, error) {
+	if len(in) == 0 {
+		var zero A
+		return zero, ErrEmptyInput
+	}
+
+	level, s := in, opts.scheduler()
+
+	for len(level) > 1 {
+		pairs := make([][2]A, len(level)/2)
+		for i := range pairs {
+			pairs[i] = [2]A{level[2*i], level[2*i+1]}
+		}
+
+		combined, err := mapOn(ctx, s, pairs, func(ctx context.Context, pair [2]A) (A, error) {
+			return combine(pair[0], pair[1]), nil
+		})
+		if err != nil {
+			var zero A
+			return zero, err
+		}
+
+		if len(level)%2 == 1 {
+			combined = append(combined, level[len(level)-1])
+		}
+
+		level = combined
+	}
+
+	return level[0], nil
+}
@@ -0,0 +1,182 @@
+package part10_test
+
+import (
+	"context"
+	"errors"
+	. "part10"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMap_should_return_outputs_in_input_order(t *testing.T) {
+	opts := ParallelOptions{MaxThreads: 2, Timeout: 1000 * time.Millisecond}
+
+	actual, err := Map(context.Background(), []int{1, 2, 3}, func(ctx context.Context, v int) (string, error) {
+		return strconv.Itoa(v * v), nil
+	}, opts)
+
+	if err != nil {
+		t.Fatalf("Wanted nil, got %v", err)
+	}
+
+	if expected := []string{"1", "4", "9"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Wanted %v, got %v", expected, actual)
+	}
+}
+
+func TestMap_should_report_per_element_errors(t *testing.T) {
+	opts := ParallelOptions{MaxThreads: 2, Timeout: 1000 * time.Millisecond}
+	odd := errors.New("odd")
+
+	actual, err := Map(context.Background(), []int{1, 2, 3, 4}, func(ctx context.Context, v int) (int, error) {
+		switch v {
+		case 1:
+			return 0, odd
+		case 3:
+			panic("Something bad happened")
+		}
+
+		return v, nil
+	}, opts)
+
+	if expected := []int{0, 2, 0, 4}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Wanted %v, got %v", expected, actual)
+	}
+
+	var errs ElementErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Wanted 2 element errors, got %v", err)
+	}
+
+	if errs[0].Index != 0 || errs[0].Err != odd {
+		t.Errorf("Wanted element 0 to fail with %v, got %v", odd, errs[0])
+	}
+
+	if errs[1].Index != 2 || !errors.Is(errs[1], ErrPanicked) {
+		t.Errorf("Wanted element 2 to panic, got %v", errs[1])
+	}
+
+	if !errors.Is(err, odd) {
+		t.Errorf("Wanted errors.Is to find %v in %v", odd, err)
+	}
+}
+
+func TestForEach_should_skip_elements_after_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int32
+	err := ForEach(ctx, []int{1, 2, 3}, func(ctx context.Context, v int) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, ParallelOptions{MaxThreads: 1, Timeout: 1000 * time.Millisecond})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted %v, got %v", context.Canceled, err)
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 0 {
+		t.Errorf("Wanted 0 calls, got %v", c)
+	}
+}
+
+func TestReduce_should_combine_in_order(t *testing.T) {
+	opts := ParallelOptions{MaxThreads: 4, Timeout: 1000 * time.Millisecond}
+	in := []string{"a", "b", "c", "d", "e"}
+
+	actual, err := Reduce(context.Background(), in, func(a, b string) string {
+		return a + b
+	}, opts)
+
+	if err != nil || actual != "abcde" {
+		t.Errorf("Wanted abcde, got %v %v", actual, err)
+	}
+
+	if _, err := Reduce(context.Background(), []int{}, func(a, b int) int { return a + b }, opts); err != ErrEmptyInput {
+		t.Errorf("Wanted %v, got %v", ErrEmptyInput, err)
+	}
+}
+
+func TestReduce_should_apply_scheduler_options(t *testing.T) {
+	var completed int32
+	opts := ParallelOptions{MaxThreads: 2, Timeout: 1000 * time.Millisecond, Options: []Option{
+		WithHooks(Hooks{OnComplete: func(JobEvent) { atomic.AddInt32(&completed, 1) }}),
+	}}
+
+	actual, err := Reduce(context.Background(), []int{1, 2, 3, 4, 5}, func(a, b int) int {
+		return a + b
+	}, opts)
+
+	if err != nil || actual != 15 {
+		t.Errorf("Wanted 15, got %v %v", actual, err)
+	}
+
+	if c := atomic.LoadInt32(&completed); c != 4 {
+		t.Errorf("Wanted 4 combinations, got %v", c)
+	}
+}
+
+func TestMap_should_match_element_errors(t *testing.T) {
+	odd := errors.New("odd")
+
+	_, err := Map(context.Background(), []int{1, 2}, func(ctx context.Context, v int) (int, error) {
+		if v == 2 {
+			return 0, odd
+		}
+
+		return v, nil
+	}, ParallelOptions{MaxThreads: 1, Timeout: 1000 * time.Millisecond})
+
+	var element ElementError
+	if !errors.As(err, &element) || element.Index != 1 {
+		t.Errorf("Wanted element 1 to fail, got %v", err)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted %v not to match %v", err, context.Canceled)
+	}
+}
+
+func TestMap_should_run_on_a_given_scheduler(t *testing.T) {
+	s := NewScheduler(2, 1000*time.Millisecond, WithTimeline())
+
+	for round := 0; round < 2; round++ {
+		actual, err := Map(context.Background(), []int{1, 2, 3}, func(ctx context.Context, v int) (int, error) {
+			return v * 2, nil
+		}, ParallelOptions{Scheduler: s})
+
+		if err != nil || !reflect.DeepEqual(actual, []int{2, 4, 6}) {
+			t.Errorf("Wanted [2 4 6], got %v %v", actual, err)
+		}
+
+		if timeline := s.Timeline(); timeline == nil || len(timeline.Entries) != 3 {
+			t.Errorf("Wanted 3 jobs run on the scheduler, got %+v", timeline)
+		}
+	}
+}
+
+func TestMap_should_cancel_an_element_that_times_out(t *testing.T) {
+	stopped := make(chan error, 1)
+
+	_, err := Map(context.Background(), []int{1}, func(ctx context.Context, v int) (int, error) {
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return 0, ctx.Err()
+	}, ParallelOptions{MaxThreads: 1, Timeout: 20 * time.Millisecond})
+
+	if !errors.Is(err, Timeout) {
+		t.Errorf("Wanted %v, got %v", Timeout, err)
+	}
+
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Wanted %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The element's context was not cancelled on timeout")
+	}
+}
@@ -4,122 +4,755 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type work func() interface{}
 
 type job struct {
-	w    work
+	w          work
+	id         JobID
+	key        string
+	memo       *memoCall
+	delay      time.Duration
+	queued     time.Time
+	middleware []Middleware
+	ctx        context.Context
+	trace      *jobTrace
+	kind       string
+	// expire cancels the context handed to w once it times out
+	expire context.CancelFunc
 }
 
 type Scheduler struct {
-	maxThreads int
-	timeout    time.Duration
-	jobs       []job
+	maxThreads     int
+	timeout        time.Duration
+	mu             sync.Mutex
+	jobs           []job
+	lastRun        int
+	checkpoint     *Checkpoint
+	flights        *flightGroup
+	memo           *Memo
+	store          ResultStore
+	ids            jobIDs
+	clock          Clock
+	resolution     time.Duration
+	retries        int
+	backoff        time.Duration
+	limiter        Limiter
+	pools          map[*workerPool]struct{}
+	capacity       int
+	overflow       OverflowPolicy
+	queueStats     QueueStats
+	space          chan struct{}
+	admission      *AdmissionController
+	metrics        *metrics
+	hooks          *Hooks
+	middleware     []Middleware
+	tracer         *tracer
+	recordTimeline bool
+	timeline       *Timeline
+	events         *eventLog
+	profiling      bool
+	profileName    string
+	timeoutStacks  bool
+	watchdog       *Watchdog
+	replaced       int
+	runs           int
+	err            error
 }
 
-func NewScheduler(maxThreads int, timeout time.Duration) *Scheduler {
+// Option configures optional Scheduler behaviour at construction time.
+type Option func(*Scheduler)
+
+func NewScheduler(maxThreads int, timeout time.Duration, opts ...Option) *Scheduler {
 	if maxThreads == 0 {
-		maxThreads = runtime.NumCPU()
+		maxThreads, _ = DefaultWorkers()
 	}
 
-	return &Scheduler{
+	s := &Scheduler{
 		maxThreads: maxThreads,
 		timeout:    timeout,
+		flights:    newFlightGroup(),
+		ids:        jobIDs{prefix: newIDPrefix()},
+		metrics:    &metrics{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	if s.clock == nil {
+		s.clock = realClock{}
+	}
+	s.flights.clock = s.clock
+
+	return s
+}
+
+func (s *Scheduler) Add(w work) JobID {
+	return s.enqueue(job{w: w})
+}
+
+// AddKeyed schedules w under an idempotency key. While a job with the same key
+// is queued or running, in this Run or a concurrent one, later submissions
+// share its Result instead of running again.
+func (s *Scheduler) AddKeyed(key string, w work) JobID {
+	return s.enqueue(job{w: w, key: key})
 }
 
-func (s *Scheduler) Add(w work) {
-	s.jobs = append(s.jobs, job{w})
+func (s *Scheduler) enqueue(j job) JobID {
+	id, _ := s.enqueueContext(context.Background(), j)
+	return id
+}
+
+func (s *Scheduler) enqueueContext(ctx context.Context, j job) (JobID, error) {
+	s.mu.Lock()
+
+	dropped, err := s.admit(ctx)
+	if err != nil {
+		s.mu.Unlock()
+
+		if ctx.Err() != nil {
+			s.events.emit(EventCancelled, "", 0, 0, err)
+		} else {
+			s.events.emit(EventRejected, "", 0, 0, err)
+		}
+
+		return "", err
+	}
+
+	j.id = s.ids.take()
+	j.queued = s.clock.Now()
+
+	if s.tracer != nil {
+		s.tracer.start(j.context(), &j)
+	}
+
+	if !dropped {
+		if s.jobs == nil {
+			// Schedulers are mostly run with batches of about the same size
+			s.jobs = make([]job, 0, s.lastRun)
+		}
+
+		s.jobs = append(s.jobs, j)
+		s.metrics.submit()
+	}
+
+	s.mu.Unlock()
+
+	if dropped {
+		s.events.emit(EventDropped, j.id, 0, 0, nil)
+		return "", ErrDropped
+	}
+
+	s.events.emit(EventEnqueued, j.id, 0, 0, nil)
+
+	if s.hooks != nil {
+		s.hooks.call(s.hooks.OnEnqueue, JobEvent{ID: j.id, Enqueued: j.queued})
+	}
+
+	return j.id, nil
 }
 
-var Timeout = errors.New("job timed out")
+var (
+	Timeout     = errors.New("job timed out")
+	ErrPanicked = errors.New("Panicked")
+)
 
+// jobRequest is an attempt at the job at index in a Run. It refers to the
+// Run's copy of the job, which stays unchanged while the Run lasts, and
+// carries its own queued time as retries and delays requeue it.
 type jobRequest struct {
-	job
-	index int
+	*job
+	index   int
+	attempt int
+	queued  time.Time
 }
 
+// Result is a job's outcome. Started and Ended bound its final attempt, and
+// Wait runs from Enqueued to Started, so it includes any earlier attempts and
+// their backoffs. Results this Run did not run itself, such as checkpointed,
+// memoized or shared ones, have no Started, Ended, Worker or Attempts.
 type Result struct {
-	Value interface{}
-	Err   error
+	Value    interface{}
+	Err      error
+	ID       JobID
+	Status   Status
+	Enqueued time.Time
+	Started  time.Time
+	Ended    time.Time
+	Wait     time.Duration
+	Duration time.Duration
+	Worker   int
+	Attempts int
+}
+
+// annotate sets result to j's final result from its completion, with its
+// metadata filled in, keeping a Status set beforehand.
+func annotate(result *Result, j *job, c *jobCompletion) {
+	*result = c.result
+	result.ID, result.Enqueued, result.Status = j.id, j.queued, statusOf(result)
+
+	if !c.start.IsZero() {
+		result.Started, result.Ended = c.start, c.end
+		result.Wait, result.Duration = c.start.Sub(j.queued), c.end.Sub(c.start)
+		result.Worker, result.Attempts = c.worker, c.attempt
+	}
 }
 
 type jobCompletion struct {
-	result Result
-	index  int
+	result  Result
+	index   int
+	attempt int
+	worker  int
+	start   time.Time
+	end     time.Time
 }
 
-func doWork(workStream chan jobRequest, resultStream chan jobCompletion, timeout time.Duration) {
-	for workToDo := range workStream {
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		ch := make(chan Result)
-		
-		go func() {
-			defer cancel()
-			defer close(ch)
-			defer func() {
-				if err := recover(); err != nil {
-					ch <- Result{
-						0,
-						fmt.Errorf("Panicked: %s", err.(string)),
-					}
-				}
-			}()
+// doWork runs batches of requests and reports each batch's completions with a
+// single send, so dispatch costs a channel operation per batch, not per job.
+// A worker exits when workStream is closed or, between batches, when its pool
+// has workers to retire; retire wakes it up for that while it waits.
+func doWork(workStream chan []jobRequest, resultStream chan []jobCompletion, w *worker, retire chan struct{}) {
+	for {
+		if w.pool != nil && (w.retiring || w.pool.retired()) {
+			return
+		}
 
-			ch <- Result{
-				workToDo.job.w(),
-				nil,
+		select {
+		case batch, ok := <-workStream:
+			if !ok {
+				return
 			}
-		}()
 
-		select {
-		case result := <-ch:
-			resultStream <- jobCompletion{
-				result,
-				workToDo.index,
+			if !w.report(resultStream, w.executeBatch(batch)) {
+				return
 			}
-		case <-ctx.Done():
-			resultStream <- jobCompletion{
-				Result{
-					0,
-					Timeout,
-				},
-				workToDo.index,
+		case <-retire:
+			if w.pool.retired() {
+				return
+			}
+		}
+	}
+}
+
+// instruments are the admission control, observers and middleware a
+// scheduler's workers share, and the clock timing their jobs. All but the
+// clock are optional.
+type instruments struct {
+	admission     *AdmissionController
+	metrics       *metrics
+	hooks         *Hooks
+	middleware    []Middleware
+	tracer        *tracer
+	events        *eventLog
+	profiling     bool
+	profileName   string
+	timeoutStacks bool
+	watchdog      *Watchdog
+	clock         Clock
+}
+
+func (s *Scheduler) instruments() *instruments {
+	return &instruments{s.admission, s.metrics, s.hooks, s.middleware, s.tracer, s.events, s.profiling, s.profileName, s.timeoutStacks, s.watchdog, s.clock}
+}
+
+// worker holds the per-goroutine state reused across jobs: the timer arming
+// its current job's timeout on the shared wheel, and the heartbeat the
+// watchdog reads.
+type worker struct {
+	*instruments
+	timeout   time.Duration
+	wheel     *TimerWheel
+	timer     WheelTimer
+	outcome   chan Result
+	id        int
+	gid       uint64
+	heartbeat heartbeat
+	pool      *workerPool
+	retiring  bool
+	batch     batchMetrics
+}
+
+func newWorker(timeout time.Duration, wheel *TimerWheel, in *instruments) *worker {
+	w := &worker{
+		instruments: in,
+		timeout:     timeout,
+		wheel:       wheel,
+	}
+	w.timer.fire = make(chan struct{}, 1)
+
+	return w
+}
+
+func (w *worker) executeBatch(batch []jobRequest) []jobCompletion {
+	completions := w.pool.completions(len(batch))
+	defer w.metrics.flush(&w.batch)
+
+	if w.events != nil {
+		for _, request := range batch {
+			w.events.emit(EventDispatched, request.id, request.attempt, w.id, nil)
+		}
+	}
+
+	w.hold(batch)
+
+	// A job starts as the one before it ends, unless observers ran in between
+	observed := w.events != nil || w.hooks != nil
+	now := w.clock.Now()
+
+	for i, workToDo := range batch {
+		if i > 0 && w.handBack(batch, i) {
+			return completions[:i]
+		}
+
+		if !w.proceed(i) {
+			return completions[:i]
+		}
+
+		start := now
+
+		if w.admission != nil && w.admission.start(workToDo.queued, start) {
+			w.metrics.unqueue(1)
+			completions[i] = jobCompletion{Result{Err: ErrShed}, workToDo.index, workToDo.attempt, w.id, start, start}
+			continue
+		}
+
+		w.metrics.start(&w.batch, workToDo.queued, start)
+		w.events.emit(EventStarted, workToDo.id, workToDo.attempt, w.id, nil)
+		w.beat(PhaseRunning, workToDo.id, workToDo.attempt)
+
+		var executeSpan [8]byte
+		if w.tracer != nil {
+			w.tracer.attemptSpan("part10.queue_wait", workToDo, w.id, newSpanID(), workToDo.queued, start, nil)
+
+			// The attempt runs under its own span, on a copy of the shared job
+			executeSpan = newSpanID()
+			traced := *workToDo.job
+			traced.ctx = ContextWithSpanContext(traced.context(), SpanContext{traced.trace.span.TraceID, executeSpan})
+			workToDo.job = &traced
+		}
+
+		if w.hooks != nil {
+			w.hooks.call(w.hooks.OnStart, w.event(workToDo, start, time.Time{}, Result{}))
+		}
+
+		result := w.execute(workToDo)
+		end := w.clock.Now()
+		w.metrics.finish(&w.batch, start, end)
+
+		if w.tracer != nil {
+			w.tracer.attemptSpan("part10.execute", workToDo, w.id, executeSpan, start, end, result.Err)
+		}
+
+		switch {
+		case errors.Is(result.Err, Timeout):
+			w.events.emit(EventTimedOut, workToDo.id, workToDo.attempt, w.id, result.Err)
+		case errors.Is(result.Err, ErrPanicked):
+			w.events.emit(EventPanicked, workToDo.id, workToDo.attempt, w.id, result.Err)
+		}
+
+		if w.hooks != nil {
+			switch event := w.event(workToDo, start, end, result); {
+			case errors.Is(result.Err, Timeout):
+				w.hooks.call(w.hooks.OnTimeout, event)
+			case errors.Is(result.Err, ErrPanicked):
+				w.hooks.call(w.hooks.OnPanic, event)
 			}
 		}
+
+		completions[i] = jobCompletion{
+			result,
+			workToDo.index,
+			workToDo.attempt,
+			w.id,
+			start,
+			end,
+		}
+
+		if now = end; observed {
+			now = w.clock.Now()
+		}
 	}
+
+	return completions
+}
+
+func (w *worker) event(r jobRequest, start, end time.Time, result Result) JobEvent {
+	return JobEvent{r.id, r.attempt, w.id, r.queued, start, end, result}
+}
+
+// execute runs r inline when there is no timeout. Otherwise r runs on its own
+// goroutine so it can be abandoned once the worker's wheel timer fires.
+func (w *worker) execute(r jobRequest) Result {
+	if w.timeout <= 0 {
+		return w.run(r)
+	}
+
+	// The channel carries over to the next job unless this one is abandoned
+	// and may still send on it
+	if w.outcome == nil {
+		w.outcome = make(chan Result, 1)
+	}
+	ch := w.outcome
+	start := w.wheel.clock.Now()
+
+	// Only stack capture needs the job goroutine's ID, so only it pays for
+	// the slot holding it
+	var id *uint64
+	if w.timeoutStacks {
+		id = new(uint64)
+		go func() {
+			atomic.StoreUint64(id, goroutineID())
+			ch <- w.run(r)
+		}()
+	} else {
+		go func() {
+			ch <- w.run(r)
+		}()
+	}
+
+	w.wheel.arm(&w.timer, w.timeout)
+
+	select {
+	case result := <-ch:
+		if !w.wheel.cancel(&w.timer) {
+			<-w.timer.fire
+		}
+
+		return result
+	case <-w.timer.fire:
+		w.outcome = nil
+
+		if r.expire != nil {
+			r.expire()
+		}
+
+		return Result{
+			Value: 0,
+			Err:   w.timeoutError(start, id),
+		}
+	}
+}
+
+// run calls r through its middleware, turning panics into ErrPanicked results.
+func (w *worker) run(r jobRequest) (result Result) {
+	defer func() {
+		if err := recover(); err != nil {
+			result = Result{
+				Value: 0,
+				Err:   fmt.Errorf("%w: %v", ErrPanicked, err),
+			}
+		}
+	}()
+
+	if !w.profiling && len(w.middleware) == 0 && len(r.middleware) == 0 {
+		return Result{
+			Value: r.w(),
+		}
+	}
+
+	return w.profiled(r, func(ctx context.Context) Result {
+		return chain(w.middleware, *r.job)(ctx, Call{r.id, r.attempt, w.id})
+	})
+}
+
+const maxBatch = 128
+
+// splitBatches cuts requests into batches small enough that every worker
+// still gets several, keeping load balanced while amortising dispatch.
+func splitBatches(requests []jobRequest, workers int) [][]jobRequest {
+	size := len(requests) / (workers * 4)
+	if size < 1 {
+		size = 1
+	}
+	if size > maxBatch {
+		size = maxBatch
+	}
+
+	batches := make([][]jobRequest, 0, (len(requests)+size-1)/size)
+
+	for len(requests) > size {
+		batches = append(batches, requests[:size:size])
+		requests = requests[size:]
+	}
+
+	if len(requests) > 0 {
+		batches = append(batches, requests)
+	}
+
+	return batches
 }
 
 func (s *Scheduler) Run() []Result {
-	jobs, totalJobs := make([]job, len(s.jobs)), len(s.jobs)
+	s.mu.Lock()
+	jobs, totalJobs := s.jobs, len(s.jobs)
 
-	copy(jobs, s.jobs)
+	s.jobs, s.lastRun = nil, totalJobs
+	s.drained()
+	workers := s.maxThreads
+	s.runs++
+	run := s.runs
+	s.mu.Unlock()
 
-	s.jobs = []job{}
+	var err error
 	results := make([]Result, totalJobs)
 
-	workStream, resultStream := make(chan jobRequest, s.maxThreads), make(chan jobCompletion, totalJobs)
-	defer close(workStream)
+	var timeline *Timeline
+	if s.recordTimeline {
+		timeline = &Timeline{Start: s.clock.Now()}
+	}
+
+	resultStream := make(chan []jobCompletion, workers)
 	defer close(resultStream)
 
-	for i := 0; i < s.maxThreads; i++ {
-		go doWork(workStream, resultStream, s.timeout)
-	}
+	wheel := s.newWheel(jobs)
+	defer wheel.Stop()
+
+	delayed := newDelayQueue()
+	requests := make([]jobRequest, 0, totalJobs)
+	pending := 0
+	leaders := make(map[int]*call)
+	dispatched := 0
+
+	for index := range jobs {
+		jobToDo := &jobs[index]
+
+		if result, ok := s.checkpoint.lookup(run, index); ok {
+			result.Status = Skipped
+			s.complete(&results[index], jobToDo, &jobCompletion{result: result, index: index})
+			continue
+		}
 
-	for index, jobToDo := range jobs {
-		workStream <- jobRequest{
-			jobToDo,
+		if jobToDo.memo != nil {
+			if result, ok := s.memo.lookup(jobToDo.memo); ok {
+				s.complete(&results[index], jobToDo, &jobCompletion{result: result, index: index})
+				firstErr(&err, s.record(run, jobToDo, index, &results[index]))
+				continue
+			}
+		}
+
+		if jobToDo.key != "" {
+			if result, ok := s.flights.cached(jobToDo.key); ok {
+				if jobToDo.memo != nil {
+					s.memo.count(true)
+				}
+
+				s.complete(&results[index], jobToDo, &jobCompletion{result: result, index: index})
+				firstErr(&err, s.record(run, jobToDo, index, &results[index]))
+				continue
+			}
+
+			c, leader := s.flights.join(jobToDo.key)
+			pending++
+
+			if jobToDo.memo != nil {
+				s.memo.count(!leader)
+			}
+
+			if !leader {
+				go func(index int) {
+					<-c.done
+					resultStream <- []jobCompletion{{result: c.result, index: index, attempt: 1}}
+				}(index)
+				continue
+			}
+
+			leaders[index] = c
+		} else {
+			pending++
+		}
+
+		request := jobRequest{
+			&jobs[index],
 			index,
+			1,
+			jobToDo.queued,
 		}
+		dispatched++
+
+		if jobToDo.delay > 0 {
+			delayed.after(wheel, jobToDo.delay, request)
+			continue
+		}
+
+		requests = append(requests, request)
 	}
 
-	for i := 0; i < totalJobs; i++ {
-		jobResult := <-resultStream
-		results[jobResult.index] = jobResult.result
+	s.metrics.unqueue(totalJobs - dispatched)
+
+	batchWorkers := workers
+	if s.limiter != nil {
+		// The limiter gates single jobs, so every batch holds one
+		batchWorkers = len(requests)
 	}
 
+	queue := splitBatches(requests, batchWorkers)
+
+	p := s.startPool(resultStream, delayed, wheel)
+	defer s.stopPool(p)
+	workStream := p.workStream
+
+	inFlight := 0
+
+	for pending > 0 {
+		var sendStream chan []jobRequest
+		var next []jobRequest
+
+		// Only the limiter gates dispatch: its batches hold one job each, while
+		// otherwise the workers and workStream's buffer bound the batches out
+		if len(queue) > 0 && (s.limiter == nil || p.inFlight(inFlight) < s.Limit()) {
+			sendStream, next = workStream, queue[0]
+		}
+
+		select {
+		case sendStream <- next:
+			queue = queue[1:]
+			inFlight += len(next)
+		case <-p.resized:
+		case <-delayed.wake:
+			for _, request := range delayed.take() {
+				queue = append(queue, []jobRequest{request})
+			}
+		case completions := <-resultStream:
+			for i := range completions {
+				jobResult := &completions[i]
+
+				if !jobResult.start.IsZero() {
+					inFlight--
+					s.observe(jobResult)
+
+					if timeline != nil {
+						timeline.add(&jobs[jobResult.index], jobResult)
+					}
+				}
+
+				// Only attempts that ran are retried, not results shared with
+				// followers of a keyed job or served from a cache
+				if err := jobResult.result.Err; err != nil && err != ErrShed && !jobResult.start.IsZero() && jobResult.attempt <= s.retries {
+					s.metrics.retry()
+					s.events.emit(EventRetried, jobs[jobResult.index].id, jobResult.attempt, jobResult.worker, err)
+					delayed.after(wheel, s.backoff<<(jobResult.attempt-1), jobRequest{
+						&jobs[jobResult.index],
+						jobResult.index,
+						jobResult.attempt + 1,
+						time.Time{},
+					})
+					continue
+				}
+
+				if !jobResult.start.IsZero() {
+					s.metrics.complete(&jobResult.result)
+				}
+
+				if len(leaders) > 0 {
+					if c, ok := leaders[jobResult.index]; ok {
+						s.flights.finish(jobs[jobResult.index].key, c, jobResult.result)
+					}
+				}
+
+				s.complete(&results[jobResult.index], &jobs[jobResult.index], jobResult)
+				firstErr(&err, s.record(run, &jobs[jobResult.index], jobResult.index, &results[jobResult.index]))
+				pending--
+			}
+
+			p.recycle(completions)
+		}
+
+		p.progressed(len(queue))
+	}
+
+	if s.admission != nil {
+		s.admission.idle()
+	}
+
+	if s.tracer != nil {
+		firstErr(&err, s.tracer.flush())
+	}
+
+	if s.events != nil {
+		firstErr(&err, s.events.writeErr())
+	}
+
+	if timeline != nil {
+		timeline.End = s.clock.Now()
+	}
+
+	s.mu.Lock()
+	s.err = err
+	if timeline != nil {
+		timeline.Workers = p.spawned
+		s.timeline = timeline
+	}
+	s.mu.Unlock()
+
 	return results
 }
+
+func (s *Scheduler) observe(c *jobCompletion) {
+	if s.limiter == nil {
+		return
+	}
+
+	if timedOut := errors.Is(c.result.Err, Timeout); timedOut || c.result.Err == nil {
+		s.limiter.Observe(c.end.Sub(c.start), timedOut)
+	}
+}
+
+// newWheel starts the wheel backing timeouts, retry backoffs and delayed jobs
+// of a single Run, or returns nil when none of them is needed.
+func (s *Scheduler) newWheel(jobs []job) *TimerWheel {
+	needed := s.timeout > 0 || s.retries > 0
+
+	for i := 0; !needed && i < len(jobs); i++ {
+		needed = jobs[i].delay > 0
+	}
+
+	if !needed {
+		return nil
+	}
+
+	return NewTimerWheel(s.clock, s.resolution)
+}
+
+// record persists the final, annotated result of the job at index in a Run,
+// returning the first error hit.
+func (s *Scheduler) record(run int, j *job, index int, result *Result) error {
+	if s.checkpoint == nil && s.store == nil {
+		return nil
+	}
+
+	err := s.checkpoint.record(run, index, *result)
+
+	if s.store == nil {
+		return err
+	}
+
+	firstErr(&err, s.store.Put(StoredResult{
+		ID:       j.id,
+		Result:   *result,
+		Status:   result.Status,
+		Finished: s.clock.Now(),
+	}))
+
+	return err
+}
+
+// firstErr sets *err to e unless it already holds an error.
+func firstErr(err *error, e error) {
+	if *err == nil {
+		*err = e
+	}
+}
+
+// Err reports the first error hit while persisting results or exporting spans
+// during the last Run to finish.
+func (s *Scheduler) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
@@ -1,9 +1,13 @@
 package part10_test
 
 import (
+	"context"
+	"errors"
 	. "part10"
 	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -52,13 +56,13 @@ func TestScheduler_should_return_expected_results_in_scheduled_order(t *testing.
 
 	actual := s.Run()
 	expected := []Result{
-		Result{6, nil},
-		Result{60, nil},
+		Result{Value: 6},
+		Result{Value: 60},
 	}
 
 	// `DeepEqual` still works for our generic results because the underlying types and values do indeed match
 	// If you look at the impl. `ValueOf` and `Type()` reach into the interface and get the concrete values
-	if !reflect.DeepEqual(actual, expected) {
+	if !reflect.DeepEqual(outcomes(actual), expected) {
 		t.Errorf("Wanted %v, got %v", expected, actual)
 	}
 
@@ -108,6 +112,40 @@ func TestScheduler_should_clean_up_goroutines(t *testing.T) {
 	}
 }
 
+func TestScheduler_should_run_as_many_jobs_in_parallel_as_workers(t *testing.T) {
+	const workers = 8
+	s := NewScheduler(workers, 0)
+
+	var started int32
+	all := make(chan struct{})
+
+	// 64 jobs make batches of two, the first job of each waiting for the others
+	for i := 0; i < 64; i++ {
+		s.Add(func() interface{} {
+			n := atomic.AddInt32(&started, 1)
+			if n == workers {
+				close(all)
+			}
+
+			if n <= workers {
+				select {
+				case <-all:
+				case <-time.After(5 * time.Second):
+					return false
+				}
+			}
+
+			return true
+		})
+	}
+
+	for i, result := range s.Run() {
+		if result.Value != true {
+			t.Fatalf("Wanted %v jobs running together, job %v gave up waiting", workers, i)
+		}
+	}
+}
+
 func TestScheduler_should_timeout_long_running_funcs(t *testing.T) {
 	s := NewScheduler(0, 1000*time.Millisecond)
 
@@ -139,11 +177,11 @@ func TestScheduler_should_timeout_long_running_funcs(t *testing.T) {
 
 	actual := s.Run()
 	expected := []Result{
-		Result{0, Timeout},
-		Result{60, nil},
+		Result{Value: 0, Err: Timeout},
+		Result{Value: 60},
 	}
 
-	if !reflect.DeepEqual(actual, expected) {
+	if !reflect.DeepEqual(outcomes(actual), expected) {
 		t.Errorf("Wanted %v, got %v", expected, actual)
 	}
 
@@ -183,12 +221,12 @@ func TestScheduler_should_manage_multiple_execs(t *testing.T) {
 
 	actual1 := s.Run()
 	expected1 := []Result{
-		Result{6, nil},
-		Result{60, nil},
-		Result{9, nil},
+		Result{Value: 6},
+		Result{Value: 60},
+		Result{Value: 9},
 	}
 
-	if !reflect.DeepEqual(actual1, expected1) {
+	if !reflect.DeepEqual(outcomes(actual1), expected1) {
 		t.Errorf("First run: Wanted %v, got %v", expected1, actual1)
 	}
 
@@ -198,16 +236,66 @@ func TestScheduler_should_manage_multiple_execs(t *testing.T) {
 
 	actual2 := s.Run()
 	expected2 := []Result{
-		Result{360, nil},
-		Result{8, nil},
-		Result{72, nil},
+		Result{Value: 360},
+		Result{Value: 8},
+		Result{Value: 72},
 	}
 
-	if !reflect.DeepEqual(actual2, expected2) {
+	if !reflect.DeepEqual(outcomes(actual2), expected2) {
 		t.Errorf("Second run: Wanted %v, got %v", expected2, actual2)
 	}
 }
 
+func TestScheduler_should_support_concurrent_runs(t *testing.T) {
+	s := NewScheduler(2, 0)
+
+	var wg sync.WaitGroup
+	var completed int32
+
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 20; i++ {
+				s.Add(func() interface{} {
+					time.Sleep(time.Millisecond)
+					return i
+				})
+				atomic.AddInt32(&completed, int32(len(s.Run())))
+
+				if err := s.Err(); err != nil {
+					t.Errorf("Wanted nil, got %v", err)
+				}
+			}
+		}()
+	}
+
+	// Err is also read while the Runs go on
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				s.Err()
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	<-stopped
+
+	if n := atomic.LoadInt32(&completed); n != 80 {
+		t.Errorf("Wanted 80 results across the Runs, got %v", n)
+	}
+}
+
 func TestScheduler_should_gracefully_handle_panics(t *testing.T) {
 	s := NewScheduler(0, 1000*time.Millisecond)
 
@@ -253,3 +341,139 @@ func TestScheduler_should_gracefully_handle_panics(t *testing.T) {
 	}
 
 }
+
+var tinyResults []Result
+
+func benchmarkTinyJobs(b *testing.B, timeout time.Duration) {
+	s := NewScheduler(8, timeout)
+	tiny := func() interface{} { return nil }
+
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < 10000; i++ {
+			s.Add(tiny)
+		}
+
+		tinyResults = s.Run()
+	}
+}
+
+func BenchmarkScheduler_TinyJobs(b *testing.B) {
+	benchmarkTinyJobs(b, 0)
+}
+
+func BenchmarkScheduler_TinyJobsWithTimeout(b *testing.B) {
+	benchmarkTinyJobs(b, 1000*time.Millisecond)
+}
+
+func TestScheduler_should_keep_to_its_allocation_budget(t *testing.T) {
+	const jobs = 10000
+
+	budgets := []struct {
+		timeout time.Duration
+		allocs  float64
+	}{
+		// Without a timeout, jobs share their allocations across a Run
+		{0, jobs / 10},
+		// With one, each job pays for the goroutine running it
+		{time.Second, jobs + jobs/10},
+	}
+
+	for _, budget := range budgets {
+		s := NewScheduler(8, budget.timeout)
+		tiny := func() interface{} { return nil }
+
+		allocs := testing.AllocsPerRun(5, func() {
+			for i := 0; i < jobs; i++ {
+				s.Add(tiny)
+			}
+
+			tinyResults = s.Run()
+		})
+
+		if allocs > budget.allocs {
+			t.Errorf("Run of %d jobs with timeout %v made %v allocations, want at most %v", jobs, budget.timeout, allocs, budget.allocs)
+		}
+	}
+}
+
+func TestScheduler_should_annotate_results(t *testing.T) {
+	s := NewScheduler(2, 0, WithRetry(1, time.Millisecond))
+
+	attempts := 0
+	id := s.Add(func() interface{} {
+		if attempts++; attempts == 1 {
+			panic("first attempt")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return 1
+	})
+
+	actual := s.Run()[0]
+
+	if actual.ID != id || actual.Status != Succeeded || actual.Attempts != 2 || actual.Worker < 1 || actual.Worker > 2 {
+		t.Errorf("Wanted %v to succeed on its second attempt, got %+v", id, actual)
+	}
+
+	if actual.Enqueued.After(actual.Started) || actual.Started.After(actual.Ended) {
+		t.Errorf("Wanted enqueue, start and end in order, got %v, %v and %v", actual.Enqueued, actual.Started, actual.Ended)
+	}
+
+	if actual.Wait != actual.Started.Sub(actual.Enqueued) || actual.Duration != actual.Ended.Sub(actual.Started) {
+		t.Errorf("Wanted the wait and duration between the timestamps, got %v and %v", actual.Wait, actual.Duration)
+	}
+
+	if actual.Duration < 10*time.Millisecond || actual.Wait < time.Millisecond {
+		t.Errorf("Wanted the final attempt's duration and a wait past the backoff, got %v and %v", actual.Duration, actual.Wait)
+	}
+}
+
+func TestScheduler_should_classify_results(t *testing.T) {
+	s := NewScheduler(2, 20*time.Millisecond)
+
+	failWith := func(err error) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call Call) Result {
+				return Result{Err: err}
+			}
+		}
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	s.Add(constant(1))
+	s.Add(func() interface{} {
+		<-release
+		return 2
+	})
+	s.Add(func() interface{} {
+		panic("oops")
+	})
+	s.AddWithMiddleware(constant(4), failWith(context.Canceled))
+	s.AddWithMiddleware(constant(5), failWith(context.DeadlineExceeded))
+	s.AddWithMiddleware(constant(6), failWith(errors.New("failed")))
+
+	expected := []Status{Succeeded, TimedOut, Panicked, Cancelled, Expired, Failed}
+	for i, result := range s.Run() {
+		if result.Status != expected[i] {
+			t.Errorf("Wanted %v at %v, got %v", expected[i], i, result.Status)
+		}
+	}
+}
+
+// outcome strips r down to its Value and Err.
+func outcome(r Result) Result {
+	return Result{Value: r.Value, Err: r.Err}
+}
+
+func outcomes(results []Result) []Result {
+	stripped := make([]Result, len(results))
+	for i, r := range results {
+		stripped[i] = outcome(r)
+	}
+
+	return stripped
+}
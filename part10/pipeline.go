@@ -0,0 +1,185 @@
+package part10
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StageFunc transforms one item. ctx is cancelled when the pipeline stops or
+// once the item times out, by the same timer that abandons it.
+type StageFunc func(ctx context.Context, in interface{}) (interface{}, error)
+
+// Stage is one worker pool of a Pipeline. Concurrency defaults to
+// DefaultWorkers() like NewScheduler, a Timeout <= 0 disables the per-item
+// timeout and Buffer bounds the items waiting for the next stage.
+type Stage struct {
+	Name        string
+	Concurrency int
+	Timeout     time.Duration
+	Buffer      int
+	Fn          StageFunc
+}
+
+// StageError reports an item that failed, timed out or panicked in a stage.
+type StageError struct {
+	Stage string
+	Item  interface{}
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Pipeline chains stages so the output of each flows into the next through a
+// bounded buffer. A slow stage fills its input buffer and blocks the stages
+// before it.
+type Pipeline struct {
+	stages []Stage
+}
+
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages}
+}
+
+type stageOutput struct {
+	value interface{}
+	err   error
+}
+
+// Run feeds in through every stage. Items that fail are reported on errs and
+// dropped. Cancelling ctx stops all stages together; out and errs are closed
+// once every stage has stopped, so both must be drained.
+func (p *Pipeline) Run(ctx context.Context, in <-chan interface{}) (out <-chan interface{}, errs <-chan *StageError) {
+	ctx, cancel := context.WithCancel(ctx)
+	errStream := make(chan *StageError)
+
+	var wg sync.WaitGroup
+
+	for _, stage := range p.stages {
+		wg.Add(1)
+		in = runStage(ctx, stage, in, errStream, wg.Done)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(errStream)
+	}()
+
+	return in, errStream
+}
+
+func runStage(ctx context.Context, stage Stage, in <-chan interface{}, errs chan<- *StageError, done func()) <-chan interface{} {
+	concurrency := stage.Concurrency
+	if concurrency == 0 {
+		concurrency, _ = DefaultWorkers()
+	}
+
+	out := make(chan interface{}, stage.Buffer)
+	workStream, resultStream := make(chan []jobRequest), make(chan []jobCompletion, concurrency)
+
+	var wheel *TimerWheel
+	if stage.Timeout > 0 {
+		wheel = NewTimerWheel(nil, DefaultTickResolution)
+	}
+
+	var mu sync.Mutex
+	items := make(map[int]interface{})
+
+	go func() {
+		defer close(workStream)
+
+		for index := 0; ; index++ {
+			var item interface{}
+			var ok bool
+
+			select {
+			case item, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			mu.Lock()
+			items[index] = item
+			mu.Unlock()
+
+			// The worker cancels itemCtx as the wheel times the item out
+			itemCtx, cancel := context.WithCancel(ctx)
+			request := jobRequest{&job{w: func() interface{} {
+				defer cancel()
+
+				value, err := stage.Fn(itemCtx, item)
+				return stageOutput{value, err}
+			}, expire: cancel}, index, 1, time.Time{}}
+
+			select {
+			case workStream <- []jobRequest{request}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			doWork(workStream, resultStream, newWorker(stage.Timeout, wheel, &instruments{clock: realClock{}}), nil)
+		}()
+	}
+
+	go func() {
+		workers.Wait()
+		wheel.Stop()
+		close(resultStream)
+	}()
+
+	go func() {
+		defer done()
+		defer close(out)
+
+		for completions := range resultStream {
+			completion := completions[0]
+
+			mu.Lock()
+			item := items[completion.index]
+			delete(items, completion.index)
+			mu.Unlock()
+
+			err := completion.result.Err
+			var value interface{}
+
+			if err == nil {
+				output := completion.result.Value.(stageOutput)
+				value, err = output.value, output.err
+			}
+
+			if err != nil {
+				select {
+				case errs <- &StageError{stage.Name, item, err}:
+				case <-ctx.Done():
+				}
+				continue
+			}
+
+			select {
+			case out <- value:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return out
+}
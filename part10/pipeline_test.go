@@ -0,0 +1,222 @@
+package part10_test
+
+import (
+	"context"
+	"errors"
+	. "part10"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func feed(items ...interface{}) <-chan interface{} {
+	in := make(chan interface{})
+
+	go func() {
+		defer close(in)
+		for _, item := range items {
+			in <- item
+		}
+	}()
+
+	return in
+}
+
+func drain(out <-chan interface{}, errs <-chan *StageError) (values []interface{}, failures []*StageError) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for err := range errs {
+			failures = append(failures, err)
+		}
+	}()
+
+	for v := range out {
+		values = append(values, v)
+	}
+	wg.Wait()
+
+	return
+}
+
+func TestPipeline_should_chain_stages_and_route_errors(t *testing.T) {
+	parse := Stage{
+		Name:        "parse",
+		Concurrency: 2,
+		Timeout:     1000 * time.Millisecond,
+		Buffer:      1,
+		Fn: func(ctx context.Context, in interface{}) (interface{}, error) {
+			return strconv.Atoi(in.(string))
+		},
+	}
+
+	double := Stage{
+		Name:        "double",
+		Concurrency: 2,
+		Timeout:     1000 * time.Millisecond,
+		Fn: func(ctx context.Context, in interface{}) (interface{}, error) {
+			if in.(int) == 3 {
+				panic("Something bad happened")
+			}
+
+			return in.(int) * 2, nil
+		},
+	}
+
+	out, errs := NewPipeline(parse, double).Run(context.Background(), feed("1", "2", "x", "3", "4"))
+	values, failures := drain(out, errs)
+
+	var actual []int
+	for _, v := range values {
+		actual = append(actual, v.(int))
+	}
+	sort.Ints(actual)
+
+	if len(actual) != 3 || actual[0] != 2 || actual[1] != 4 || actual[2] != 8 {
+		t.Errorf("Wanted [2 4 8], got %v", actual)
+	}
+
+	if len(failures) != 2 {
+		t.Fatalf("Wanted 2 failures, got %v", failures)
+	}
+
+	for _, failure := range failures {
+		switch failure.Stage {
+		case "parse":
+			if failure.Item != "x" {
+				t.Errorf("Wanted x to fail parsing, got %v", failure.Item)
+			}
+		case "double":
+			if failure.Item != 3 || !errors.Is(failure, ErrPanicked) {
+				t.Errorf("Wanted 3 to panic, got %v: %v", failure.Item, failure.Err)
+			}
+		}
+	}
+}
+
+func TestPipeline_should_apply_backpressure(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	fetch := Stage{
+		Name:        "fetch",
+		Concurrency: 4,
+		Buffer:      2,
+		Fn: func(ctx context.Context, in interface{}) (interface{}, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				m := atomic.LoadInt32(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+
+			return in, nil
+		},
+	}
+
+	write := Stage{
+		Name:        "write",
+		Concurrency: 1,
+		Fn: func(ctx context.Context, in interface{}) (interface{}, error) {
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			return in, nil
+		},
+	}
+
+	items := make([]interface{}, 50)
+	for i := range items {
+		items[i] = i
+	}
+
+	out, errs := NewPipeline(fetch, write).Run(context.Background(), feed(items...))
+	values, _ := drain(out, errs)
+
+	if len(values) != 50 {
+		t.Errorf("Wanted 50 values, got %v", len(values))
+	}
+
+	// fetch's workers and results, its router, its buffer, write's feeder and write's worker
+	if m := atomic.LoadInt32(&maxInFlight); m > 4+4+1+2+1+1 {
+		t.Errorf("Wanted at most 13 items between stages, got %v", m)
+	}
+}
+
+func TestPipeline_should_cancel_all_stages_together(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	in := make(chan interface{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case in <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	identity := func(ctx context.Context, in interface{}) (interface{}, error) {
+		return in, nil
+	}
+
+	out, errs := NewPipeline(
+		Stage{Name: "a", Concurrency: 2, Fn: identity},
+		Stage{Name: "b", Concurrency: 2, Fn: identity},
+	).Run(ctx, in)
+
+	<-out
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		drain(out, errs)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Pipeline did not stop after cancel")
+	}
+}
+
+func TestPipeline_should_cancel_items_that_time_out(t *testing.T) {
+	stopped := make(chan error, 1)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	wait := Stage{
+		Name:    "wait",
+		Timeout: 20 * time.Millisecond,
+		Fn: func(ctx context.Context, in interface{}) (interface{}, error) {
+			<-ctx.Done()
+			stopped <- ctx.Err()
+
+			// Outlive the timeout to have the item abandoned
+			<-release
+			return in, nil
+		},
+	}
+
+	values, failures := drain(NewPipeline(wait).Run(context.Background(), feed(1)))
+
+	if len(values) != 0 || len(failures) != 1 || !errors.Is(failures[0], Timeout) {
+		t.Fatalf("Wanted 1 to time out, got %v and %v", values, failures)
+	}
+
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("Wanted %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Stage function kept running after its item timed out")
+	}
+}
@@ -0,0 +1,280 @@
+package part10
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"time"
+)
+
+// Profiler labels set on every job run by a scheduler WithProfileLabels.
+const (
+	LabelJobType   = "job_type"
+	LabelJobID     = "job_id"
+	LabelScheduler = "scheduler"
+)
+
+var ErrMalformedProfile = errors.New("malformed profile")
+
+// WithProfileLabels runs every job under pprof.Do with its job type, job ID
+// and the scheduler's name as labels, so CPU profiles attribute samples to
+// them. Goroutines a job starts inherit its labels. Labels left empty are
+// omitted.
+func WithProfileLabels(name string) Option {
+	return func(s *Scheduler) {
+		s.profiling, s.profileName = true, name
+	}
+}
+
+// AddTyped schedules w labelled with jobType, which profiles group it by.
+// Memoized jobs are typed by their function's name.
+func (s *Scheduler) AddTyped(jobType string, w work) JobID {
+	return s.enqueue(job{w: w, kind: jobType})
+}
+
+func (w *worker) labels(r jobRequest) pprof.LabelSet {
+	labels := []string{LabelJobID, string(r.id)}
+
+	if r.kind != "" {
+		labels = append(labels, LabelJobType, r.kind)
+	}
+
+	if w.profileName != "" {
+		labels = append(labels, LabelScheduler, w.profileName)
+	}
+
+	return pprof.Labels(labels...)
+}
+
+// ProfileHandler serves a CPU profile like net/http/pprof's, recording for the
+// seconds query parameter (30 by default). Any other query parameter keeps
+// only the samples carrying that label value, such as ?job_type=resize.
+func ProfileHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		seconds, err := strconv.Atoi(query.Get("seconds"))
+		if err != nil || seconds <= 0 {
+			seconds = 30
+		}
+		query.Del("seconds")
+
+		labels := make(map[string]string)
+		for key := range query {
+			labels[key] = query.Get(key)
+		}
+
+		var profile bytes.Buffer
+		if err := pprof.StartCPUProfile(&profile); err != nil {
+			http.Error(w, fmt.Sprintf("Could not enable CPU profiling: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+		case <-r.Context().Done():
+		}
+		pprof.StopCPUProfile()
+
+		var filtered bytes.Buffer
+		if err := FilterProfile(&profile, &filtered, labels); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+		w.Write(filtered.Bytes())
+	})
+}
+
+// FilterProfile copies a gzipped pprof profile from r to w, keeping only the
+// samples whose string labels match every entry of labels. Locations,
+// functions and the rest of the profile are kept as they are.
+func FilterProfile(r io.Reader, w io.Writer, labels map[string]string) error {
+	unzipped, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	profile, err := io.ReadAll(unzipped)
+	if err != nil {
+		return err
+	}
+
+	table, err := profileStrings(profile)
+	if err != nil {
+		return err
+	}
+
+	zipped := gzip.NewWriter(w)
+
+	err = eachField(profile, func(field int, wireType int, raw, value []byte) error {
+		if field == profileSample && wireType == wireBytes {
+			keep, err := sampleMatches(value, table, labels)
+			if err != nil || !keep {
+				return err
+			}
+		}
+
+		_, err := zipped.Write(raw)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return zipped.Close()
+}
+
+// Field numbers of profile.proto used for filtering.
+const (
+	profileSample      = 2
+	profileStringTable = 6
+	sampleLabel        = 3
+	labelKey           = 1
+	labelStr           = 2
+)
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func profileStrings(profile []byte) ([]string, error) {
+	var table []string
+
+	err := eachField(profile, func(field int, wireType int, raw, value []byte) error {
+		if field == profileStringTable && wireType == wireBytes {
+			table = append(table, string(value))
+		}
+
+		return nil
+	})
+
+	return table, err
+}
+
+func sampleMatches(sample []byte, table []string, labels map[string]string) (bool, error) {
+	matched := 0
+
+	err := eachField(sample, func(field int, wireType int, raw, value []byte) error {
+		if field != sampleLabel || wireType != wireBytes {
+			return nil
+		}
+
+		var key, str uint64
+		err := eachField(value, func(field int, wireType int, raw, value []byte) error {
+			if wireType != wireVarint {
+				return nil
+			}
+
+			switch field {
+			case labelKey:
+				key, _ = readVarint(value)
+			case labelStr:
+				str, _ = readVarint(value)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if key >= uint64(len(table)) || str >= uint64(len(table)) {
+			return ErrMalformedProfile
+		}
+
+		if expected, ok := labels[table[key]]; ok && str != 0 && table[str] == expected {
+			matched++
+		}
+
+		return nil
+	})
+
+	return matched == len(labels), err
+}
+
+// eachField calls f for every field of the message in data with its raw bytes,
+// tag included, and its value: the payload for length-delimited fields and the
+// encoded number otherwise.
+func eachField(data []byte, f func(field int, wireType int, raw, value []byte) error) error {
+	for len(data) > 0 {
+		tag, n := readVarint(data)
+		if n == 0 {
+			return ErrMalformedProfile
+		}
+
+		start, size := n, 0
+		switch wireType := int(tag & 7); wireType {
+		case wireVarint:
+			_, size = readVarint(data[start:])
+			if size == 0 {
+				return ErrMalformedProfile
+			}
+		case wireFixed64:
+			size = 8
+		case wireFixed32:
+			size = 4
+		case wireBytes:
+			length, m := readVarint(data[start:])
+			if m == 0 || length > uint64(len(data)) {
+				return ErrMalformedProfile
+			}
+			start, size = start+m, int(length)
+		default:
+			return ErrMalformedProfile
+		}
+
+		if start+size > len(data) {
+			return ErrMalformedProfile
+		}
+
+		if err := f(int(tag>>3), int(tag&7), data[:start+size], data[start:start+size]); err != nil {
+			return err
+		}
+
+		data = data[start+size:]
+	}
+
+	return nil
+}
+
+// readVarint decodes a varint, returning the number of bytes read or 0 if data
+// is truncated.
+func readVarint(data []byte) (uint64, int) {
+	var value uint64
+
+	for i := 0; i < len(data) && i < 10; i++ {
+		value |= uint64(data[i]&0x7f) << (7 * i)
+
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+
+	return 0, 0
+}
+
+// profiled runs call under pprof.Do with r's labels when profiling.
+func (w *worker) profiled(r jobRequest, call func(ctx context.Context) Result) (result Result) {
+	if !w.profiling {
+		return call(r.context())
+	}
+
+	pprof.Do(r.context(), w.labels(r), func(ctx context.Context) {
+		result = call(ctx)
+	})
+
+	return result
+}
@@ -0,0 +1,182 @@
+package part10_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	. "part10"
+	"testing"
+)
+
+// protoFields splits a protocol buffer message into its fields, keeping the
+// varints decoded and the length-delimited payloads as they are.
+func protoFields(t *testing.T, data []byte) (fields []struct {
+	number int
+	value  uint64
+	bytes  []byte
+}) {
+	varint := func() uint64 {
+		var v uint64
+		for shift := 0; ; shift += 7 {
+			b := data[0]
+			data = data[1:]
+			v |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return v
+			}
+		}
+	}
+
+	for len(data) > 0 {
+		tag := varint()
+		field := struct {
+			number int
+			value  uint64
+			bytes  []byte
+		}{number: int(tag >> 3)}
+
+		switch tag & 7 {
+		case 0:
+			field.value = varint()
+		case 1:
+			data = data[8:]
+		case 2:
+			n := varint()
+			field.bytes, data = data[:n], data[n:]
+		case 5:
+			data = data[4:]
+		default:
+			t.Fatalf("Unexpected wire type in %v", tag)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// profileSamples returns the string labels of every sample in a gzipped
+// profile.
+func profileSamples(t *testing.T, profile []byte) []map[string]string {
+	unzipped, err := gzip.NewReader(bytes.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(unzipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var table []string
+	var samples [][]byte
+	for _, field := range protoFields(t, data) {
+		switch field.number {
+		case 2:
+			samples = append(samples, field.bytes)
+		case 6:
+			table = append(table, string(field.bytes))
+		}
+	}
+
+	labels := make([]map[string]string, len(samples))
+	for i, sample := range samples {
+		labels[i] = make(map[string]string)
+
+		for _, field := range protoFields(t, sample) {
+			if field.number != 3 {
+				continue
+			}
+
+			var key, str uint64
+			for _, labelField := range protoFields(t, field.bytes) {
+				switch labelField.number {
+				case 1:
+					key = labelField.value
+				case 2:
+					str = labelField.value
+				}
+			}
+
+			labels[i][table[key]] = table[str]
+		}
+	}
+
+	return labels
+}
+
+func spin(stop chan struct{}) func() interface{} {
+	return func() interface{} {
+		for n := 0; ; n++ {
+			select {
+			case <-stop:
+				return n
+			default:
+			}
+		}
+	}
+}
+
+func TestProfileHandler_should_filter_samples_by_job_labels(t *testing.T) {
+	s := NewScheduler(2, 0, WithProfileLabels("test"))
+
+	stop := make(chan struct{})
+	spinA := s.AddTyped("spin-a", spin(stop))
+	s.AddTyped("spin-b", spin(stop))
+
+	done := make(chan []Result)
+	go func() {
+		done <- s.Run()
+	}()
+
+	server := httptest.NewServer(ProfileHandler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "?seconds=1&job_type=spin-a")
+	close(stop)
+	<-done
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	profile, _ := io.ReadAll(resp.Body)
+	samples := profileSamples(t, profile)
+
+	if len(samples) == 0 {
+		t.Fatalf("Wanted samples of spin-a, got none")
+	}
+
+	for _, labels := range samples {
+		if labels[LabelJobType] != "spin-a" || labels[LabelJobID] != string(spinA) || labels[LabelScheduler] != "test" {
+			t.Fatalf("Wanted only spin-a samples, got %v", labels)
+		}
+	}
+
+	var filtered bytes.Buffer
+	if err := FilterProfile(bytes.NewReader(profile), &filtered, map[string]string{LabelJobType: "spin-b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if samples := profileSamples(t, filtered.Bytes()); len(samples) != 0 {
+		t.Errorf("Wanted no spin-b samples left, got %v", samples)
+	}
+}
+
+func TestFilterProfile_should_reject_malformed_profiles(t *testing.T) {
+	var profile bytes.Buffer
+	zipped := gzip.NewWriter(&profile)
+	zipped.Write([]byte{0x12, 0x7f, 0x01})
+	zipped.Close()
+
+	if err := FilterProfile(&profile, io.Discard, nil); err != ErrMalformedProfile {
+		t.Errorf("Wanted %v, got %v", ErrMalformedProfile, err)
+	}
+
+	if err := FilterProfile(bytes.NewReader([]byte("not gzip")), io.Discard, nil); err == nil {
+		t.Errorf("Wanted an error for a profile that is not gzipped")
+	}
+
+}
@@ -0,0 +1,121 @@
+package part10
+
+import (
+	"context"
+	"errors"
+)
+
+// OverflowPolicy decides what happens to a submission that finds the queue
+// full.
+type OverflowPolicy int
+
+const (
+	// Block waits until Run takes the queued jobs or the context is done.
+	Block OverflowPolicy = iota
+	// Reject fails the submission with ErrQueueFull.
+	Reject
+	// DropOldest discards the job queued first to make room.
+	DropOldest
+	// DropNewest discards the submitted job, failing it with ErrDropped.
+	DropNewest
+)
+
+var (
+	ErrQueueFull = errors.New("queue full")
+	ErrDropped   = errors.New("job dropped from a full queue")
+)
+
+// QueueStats counts the submissions that found the queue full, by policy.
+type QueueStats struct {
+	Blocked       uint64
+	Rejected      uint64
+	DroppedOldest uint64
+	DroppedNewest uint64
+}
+
+// WithQueue bounds the jobs waiting for the next Run to capacity, applying
+// policy when a submission finds the queue full. Add and the other Add methods
+// block without a deadline under Block and return an empty JobID when the
+// job is rejected or dropped; use AddContext to bound the wait or see the
+// error.
+func WithQueue(capacity int, policy OverflowPolicy) Option {
+	return func(s *Scheduler) {
+		s.capacity = capacity
+		s.overflow = policy
+	}
+}
+
+// AddContext schedules w like Add, carrying the values of ctx to the job's
+// middleware and spans. It returns ctx.Err() if ctx is done while
+// blocked on a full queue, ErrQueueFull if the queue rejects it, ErrDropped if
+// the queue discards it and ErrOverloaded if admission control refuses it.
+func (s *Scheduler) AddContext(ctx context.Context, w work) (JobID, error) {
+	return s.enqueueContext(ctx, job{w: w, ctx: valuesOnly{ctx}})
+}
+
+// QueueStats returns the overflow counters since the scheduler was created.
+func (s *Scheduler) QueueStats() QueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queueStats
+}
+
+// admit makes room for one more job under the overflow policy. It is called
+// with s.mu held, which Block releases while waiting. dropped reports that the
+// submitted job must be discarded.
+func (s *Scheduler) admit(ctx context.Context) (dropped bool, err error) {
+	if s.admission != nil && !s.admission.admit() {
+		return false, ErrOverloaded
+	}
+
+	blocked := false
+
+	for s.capacity > 0 && len(s.jobs) >= s.capacity {
+		switch s.overflow {
+		case Reject:
+			s.queueStats.Rejected++
+			return false, ErrQueueFull
+		case DropOldest:
+			s.queueStats.DroppedOldest++
+			s.events.emit(EventDropped, s.jobs[0].id, 0, 0, nil)
+			s.jobs = s.jobs[1:]
+			s.metrics.unqueue(1)
+		case DropNewest:
+			s.queueStats.DroppedNewest++
+			return true, nil
+		default:
+			if !blocked {
+				s.queueStats.Blocked++
+				blocked = true
+			}
+
+			if s.space == nil {
+				s.space = make(chan struct{})
+			}
+			space := s.space
+
+			s.mu.Unlock()
+			select {
+			case <-space:
+			case <-ctx.Done():
+			}
+			s.mu.Lock()
+
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// drained wakes the submissions blocked on a full queue once Run has taken
+// the queued jobs. It is called with s.mu held.
+func (s *Scheduler) drained() {
+	if s.space != nil {
+		close(s.space)
+		s.space = nil
+	}
+}
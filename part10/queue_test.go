@@ -0,0 +1,119 @@
+package part10_test
+
+import (
+	"context"
+	. "part10"
+	"testing"
+	"time"
+)
+
+func constant(v int) func() interface{} {
+	return func() interface{} { return v }
+}
+
+func values(results []Result) []interface{} {
+	vs := make([]interface{}, len(results))
+	for i, result := range results {
+		vs[i] = result.Value
+	}
+
+	return vs
+}
+
+func TestScheduler_should_reject_when_the_queue_is_full(t *testing.T) {
+	s := NewScheduler(1, 0, WithQueue(2, Reject))
+
+	s.Add(constant(1))
+	s.Add(constant(2))
+
+	if _, err := s.AddContext(context.Background(), constant(3)); err != ErrQueueFull {
+		t.Errorf("Wanted %v, got %v", ErrQueueFull, err)
+	}
+
+	if id := s.Add(constant(4)); id != "" {
+		t.Errorf("Wanted no JobID for a rejected job, got %v", id)
+	}
+
+	if actual := values(s.Run()); len(actual) != 2 || actual[0] != 1 || actual[1] != 2 {
+		t.Errorf("Wanted [1 2], got %v", actual)
+	}
+
+	if stats := s.QueueStats(); stats != (QueueStats{Rejected: 2}) {
+		t.Errorf("Wanted 2 rejections, got %+v", stats)
+	}
+}
+
+func TestScheduler_should_drop_jobs_when_the_queue_is_full(t *testing.T) {
+	cases := []struct {
+		policy   OverflowPolicy
+		expected []interface{}
+		stats    QueueStats
+		refused  error
+	}{
+		{DropOldest, []interface{}{3, 4}, QueueStats{DroppedOldest: 2}, nil},
+		{DropNewest, []interface{}{1, 2}, QueueStats{DroppedNewest: 2}, ErrDropped},
+	}
+
+	for _, c := range cases {
+		s := NewScheduler(1, 0, WithQueue(2, c.policy))
+
+		for i := 1; i <= 4; i++ {
+			var want error
+			if i > 2 {
+				want = c.refused
+			}
+
+			if id, err := s.AddContext(context.Background(), constant(i)); err != want || (err != nil) != (id == "") {
+				t.Fatalf("Wanted %v, got %q %v", want, id, err)
+			}
+		}
+
+		if actual := values(s.Run()); len(actual) != 2 || actual[0] != c.expected[0] || actual[1] != c.expected[1] {
+			t.Errorf("Wanted %v, got %v", c.expected, actual)
+		}
+
+		if stats := s.QueueStats(); stats != c.stats {
+			t.Errorf("Wanted %+v, got %+v", c.stats, stats)
+		}
+	}
+}
+
+func TestScheduler_should_block_until_the_queue_drains(t *testing.T) {
+	s := NewScheduler(1, 0, WithQueue(1, Block))
+	s.Add(constant(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := s.AddContext(ctx, constant(2)); err != context.DeadlineExceeded {
+		t.Errorf("Wanted %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	added := make(chan error)
+	go func() {
+		_, err := s.AddContext(context.Background(), constant(3))
+		added <- err
+	}()
+
+	select {
+	case err := <-added:
+		t.Fatalf("Wanted AddContext to block, returned %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if actual := values(s.Run()); len(actual) != 1 || actual[0] != 1 {
+		t.Errorf("Wanted [1], got %v", actual)
+	}
+
+	if err := <-added; err != nil {
+		t.Errorf("Wanted no error, got %v", err)
+	}
+
+	if actual := values(s.Run()); len(actual) != 1 || actual[0] != 3 {
+		t.Errorf("Wanted [3], got %v", actual)
+	}
+
+	if stats := s.QueueStats(); stats != (QueueStats{Blocked: 2}) {
+		t.Errorf("Wanted 2 blocked submissions, got %+v", stats)
+	}
+}
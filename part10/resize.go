@@ -0,0 +1,224 @@
+package part10
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// workerPool is the set of workers serving a Run in progress, registered on
+// the scheduler so Resize can grow or shrink it while the Run goes on. With a
+// watchdog, it also tracks its workers and when Run last progressed.
+type workerPool struct {
+	progress     int64
+	queued       int64
+	abandoned    int64
+	retiring     int32
+	workStream   chan []jobRequest
+	resultStream chan []jobCompletion
+	spare        chan []jobCompletion
+	retire       chan struct{}
+	done         chan struct{}
+	watched      chan struct{}
+	resized      chan struct{}
+	delayed      *delayQueue
+	instruments  *instruments
+	timeout      time.Duration
+	wheel        *TimerWheel
+	size         int
+	spawned      int
+	workers      []*worker
+	health       HealthStatus
+}
+
+// startPool sizes the pool to the current maxThreads rather than the count Run
+// planned with, so a Resize racing with the start of Run is not lost.
+func (s *Scheduler) startPool(resultStream chan []jobCompletion, delayed *delayQueue, wheel *TimerWheel) *workerPool {
+	p := &workerPool{
+		workStream:   make(chan []jobRequest, cap(resultStream)),
+		resultStream: resultStream,
+		spare:        make(chan []jobCompletion, cap(resultStream)),
+		retire:       make(chan struct{}),
+		done:         make(chan struct{}),
+		resized:      make(chan struct{}, 1),
+		delayed:      delayed,
+		instruments:  s.instruments(),
+		timeout:      s.timeout,
+		wheel:        wheel,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pools == nil {
+		s.pools = make(map[*workerPool]struct{})
+	}
+	s.pools[p] = struct{}{}
+
+	p.resize(s.maxThreads)
+
+	if s.watchdog != nil {
+		p.watched = make(chan struct{})
+		p.progressed(0)
+		go s.watch(p)
+	}
+
+	return p
+}
+
+// completions returns a buffer for the completions of n jobs, reusing one Run
+// has recycled if it is large enough.
+func (p *workerPool) completions(n int) []jobCompletion {
+	if p != nil {
+		select {
+		case spare := <-p.spare:
+			if cap(spare) >= n {
+				return spare[:n]
+			}
+		default:
+		}
+	}
+
+	return make([]jobCompletion, n)
+}
+
+// recycle hands completions Run is done with back to the workers, or leaves
+// them to the garbage collector when enough are spare already.
+func (p *workerPool) recycle(completions []jobCompletion) {
+	select {
+	case p.spare <- completions[:0]:
+	default:
+	}
+}
+
+// stopPool closes workStream, so every worker exits once it has finished its
+// current batch, and waits for the pool's watchdog to stop.
+func (s *Scheduler) stopPool(p *workerPool) {
+	s.mu.Lock()
+	delete(s.pools, p)
+	close(p.done)
+	close(p.workStream)
+	s.mu.Unlock()
+
+	if p.watched != nil {
+		<-p.watched
+	}
+}
+
+// Resize changes the number of workers, including those of Runs in progress.
+// Growing starts workers immediately; shrinking retires workers as they finish
+// their current job, handing the rest of their batch back to the pool, so no
+// request is dropped or run twice. 0 or less picks
+// DefaultWorkers() like NewScheduler.
+func (s *Scheduler) Resize(maxThreads int) {
+	if maxThreads <= 0 {
+		maxThreads, _ = DefaultWorkers()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxThreads = maxThreads
+
+	for p := range s.pools {
+		p.resize(maxThreads)
+
+		// Wake Run, which may be holding back work under the old limit
+		select {
+		case p.resized <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *workerPool) resize(size int) {
+	for ; p.size < size; p.size++ {
+		// Keep a worker still due to retire rather than start another
+		if !p.retired() {
+			p.spawn()
+		}
+	}
+
+	if retiring := p.size - size; retiring > 0 {
+		p.size = size
+		atomic.AddInt32(&p.retiring, int32(retiring))
+
+		// Wake the workers waiting for a batch
+		go func() {
+			for atomic.LoadInt32(&p.retiring) > 0 {
+				select {
+				case p.retire <- struct{}{}:
+				case <-p.done:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// retired claims one of the pending retirements, telling the calling worker
+// to exit.
+func (p *workerPool) retired() bool {
+	for {
+		n := atomic.LoadInt32(&p.retiring)
+		if n == 0 {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt32(&p.retiring, n, n-1) {
+			return true
+		}
+	}
+}
+
+// handBack retires w before batch[i] if the pool is due to shrink, handing
+// the rest of batch back to the pool like the watchdog does for a stuck
+// worker, so a shrink takes effect before a long batch is over.
+func (w *worker) handBack(batch []jobRequest, i int) bool {
+	if w.pool == nil || !w.pool.retired() {
+		return false
+	}
+
+	rest := batch[i:]
+
+	if w.watchdog != nil {
+		w.heartbeat.mu.Lock()
+		defer w.heartbeat.mu.Unlock()
+
+		if w.heartbeat.replaced {
+			// The watchdog handed the rest back already, and the worker
+			// replacing w stays on instead
+			atomic.AddInt32(&w.pool.retiring, 1)
+			return true
+		}
+
+		rest = batch[i:w.heartbeat.cut]
+		w.heartbeat.cut = i
+	}
+
+	w.retiring = true
+	atomic.AddInt64(&w.pool.abandoned, int64(len(rest)))
+	w.pool.delayed.push(rest...)
+
+	return true
+}
+
+// spawn starts a worker.
+func (p *workerPool) spawn() {
+	w := newWorker(p.timeout, p.wheel, p.instruments)
+	w.id = p.spawned + 1
+	w.pool = p
+	p.spawned++
+
+	if p.instruments.watchdog != nil {
+		p.workers = append(p.workers, w)
+	}
+
+	go func() {
+		if w.watchdog != nil {
+			atomic.StoreUint64(&w.gid, goroutineID())
+			defer w.beat(phaseExited, "", 0)
+		}
+
+		doWork(p.workStream, p.resultStream, w, p.retire)
+	}()
+}
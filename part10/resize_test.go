@@ -0,0 +1,162 @@
+package part10_test
+
+import (
+	"fmt"
+	. "part10"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_grow_workers_during_run(t *testing.T) {
+	s := NewScheduler(1, 0)
+
+	// Every job waits for all four to have started, which needs four workers
+	var barrier sync.WaitGroup
+	barrier.Add(4)
+
+	started := make(chan struct{}, 4)
+	for i := 0; i < 4; i++ {
+		s.Add(func() interface{} {
+			started <- struct{}{}
+			barrier.Done()
+			barrier.Wait()
+			return nil
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Run()
+		close(done)
+	}()
+
+	<-started
+	s.Resize(4)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not finish after growing the pool")
+	}
+}
+
+func TestScheduler_should_shrink_workers_without_losing_jobs(t *testing.T) {
+	s := NewScheduler(8, 0)
+
+	runs := make([]int32, 400)
+	var started, inFlight, maxInFlight int32
+
+	for i := range runs {
+		i := i
+		s.Add(func() interface{} {
+			atomic.AddInt32(&runs[i], 1)
+
+			n := atomic.AddInt32(&inFlight, 1)
+			switch atomic.AddInt32(&started, 1) {
+			case 16:
+				s.Resize(2)
+			default:
+				// Retiring workers finish their current batch first, which
+				// is long over once half the jobs have started
+				if atomic.LoadInt32(&started) > 200 && n > atomic.LoadInt32(&maxInFlight) {
+					atomic.StoreInt32(&maxInFlight, n)
+				}
+			}
+
+			time.Sleep(100 * time.Microsecond)
+			atomic.AddInt32(&inFlight, -1)
+			return i
+		})
+	}
+
+	results := s.Run()
+
+	for i, result := range results {
+		if result.Value != i {
+			t.Fatalf("Wanted %v, got %v", i, result.Value)
+		}
+
+		if n := atomic.LoadInt32(&runs[i]); n != 1 {
+			t.Fatalf("Wanted job %v to run once, ran %v times", i, n)
+		}
+	}
+
+	if m := atomic.LoadInt32(&maxInFlight); m > 2 {
+		t.Errorf("Wanted at most 2 jobs in flight after shrinking, got %v", m)
+	}
+}
+
+func TestScheduler_should_shrink_workers_mid_batch(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithWatchdog(Watchdog{Interval: time.Hour})}} {
+		// 64 jobs over 2 workers go out in batches of 8
+		s := NewScheduler(2, 0, opts...)
+
+		runs := make([]int32, 64)
+		var started, inFlight, maxInFlight int32
+
+		// The first job of each worker waits for the other, so both are
+		// in the middle of a batch as the pool shrinks
+		var barrier sync.WaitGroup
+		barrier.Add(2)
+
+		for i := range runs {
+			i := i
+			s.Add(func() interface{} {
+				atomic.AddInt32(&runs[i], 1)
+
+				n := atomic.AddInt32(&inFlight, 1)
+				switch atomic.AddInt32(&started, 1) {
+				case 1:
+					barrier.Done()
+					barrier.Wait()
+				case 2:
+					s.Resize(1)
+					barrier.Done()
+					barrier.Wait()
+				default:
+					// The first worker to finish a job retires, so every job
+					// after the first two runs alone
+					if n > atomic.LoadInt32(&maxInFlight) {
+						atomic.StoreInt32(&maxInFlight, n)
+					}
+				}
+
+				time.Sleep(100 * time.Microsecond)
+				atomic.AddInt32(&inFlight, -1)
+				return i
+			})
+		}
+
+		results := s.Run()
+
+		for i, result := range results {
+			if result.Value != i {
+				t.Fatalf("Wanted %v, got %v", i, result.Value)
+			}
+
+			if n := atomic.LoadInt32(&runs[i]); n != 1 {
+				t.Fatalf("Wanted job %v to run once, ran %v times", i, n)
+			}
+		}
+
+		if m := atomic.LoadInt32(&maxInFlight); m > 1 {
+			t.Errorf("Wanted 1 job in flight once a worker retired, got %v", m)
+		}
+	}
+}
+
+func TestScheduler_should_resize_idle_scheduler(t *testing.T) {
+	s := NewScheduler(2, 0)
+	s.Resize(5)
+
+	if limit := s.Limit(); limit != 5 {
+		t.Errorf("Wanted 5 workers, got %v", limit)
+	}
+
+	s.Add(func() interface{} { return fmt.Sprint("ok") })
+	if actual := s.Run(); actual[0].Value != "ok" {
+		t.Errorf("Wanted ok, got %v", actual[0].Value)
+	}
+}
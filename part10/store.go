@@ -0,0 +1,469 @@
+package part10
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobID identifies a job across the scheduler, its result store and, for
+// file-backed stores, later processes.
+type JobID string
+
+func newIDPrefix() string {
+	buf := make([]byte, 8)
+
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+const idBlock = 64
+
+// jobIDs numbers jobs after a random prefix. IDs are cut from a string
+// formatting a block of them at once, so that one costs no allocation of its
+// own.
+type jobIDs struct {
+	prefix string
+	next   uint64
+	block  string
+	ends   [idBlock]int
+	used   int
+}
+
+func (ids *jobIDs) take() JobID {
+	if ids.block == "" || ids.used == idBlock {
+		ids.fill()
+	}
+
+	start := 0
+	if ids.used > 0 {
+		start = ids.ends[ids.used-1]
+	}
+
+	id := ids.block[start:ids.ends[ids.used]]
+	ids.used++
+
+	return JobID(id)
+}
+
+func (ids *jobIDs) fill() {
+	var b strings.Builder
+	b.Grow(idBlock * (len(ids.prefix) + 8))
+
+	for i := range ids.ends {
+		ids.next++
+
+		var digits [20]byte
+		b.WriteString(ids.prefix)
+		b.WriteByte('-')
+		b.Write(strconv.AppendUint(digits[:0], ids.next, 10))
+		ids.ends[i] = b.Len()
+	}
+
+	ids.block, ids.used = b.String(), 0
+}
+
+type Status int
+
+const (
+	Succeeded Status = iota + 1
+	Failed
+	TimedOut
+	Panicked
+	// Cancelled jobs failed with context.Canceled.
+	Cancelled
+	// Skipped jobs were not run, their result restored from a checkpoint.
+	Skipped
+	// Expired jobs were shed after waiting too long or failed with
+	// context.DeadlineExceeded.
+	Expired
+)
+
+var statusNames = map[Status]string{
+	Succeeded: "succeeded",
+	Failed:    "failed",
+	TimedOut:  "timed_out",
+	Panicked:  "panicked",
+	Cancelled: "cancelled",
+	Skipped:   "skipped",
+	Expired:   "expired",
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+func statusOf(result *Result) Status {
+	switch {
+	case result.Status != 0:
+		return result.Status
+	case result.Err == nil:
+		return Succeeded
+	case errors.Is(result.Err, Timeout):
+		return TimedOut
+	case errors.Is(result.Err, ErrPanicked):
+		return Panicked
+	case errors.Is(result.Err, context.Canceled):
+		return Cancelled
+	case errors.Is(result.Err, ErrShed), errors.Is(result.Err, context.DeadlineExceeded):
+		return Expired
+	default:
+		return Failed
+	}
+}
+
+type StoredResult struct {
+	ID       JobID
+	Result   Result
+	Status   Status
+	Finished time.Time
+}
+
+// ResultQuery selects stored results. Zero fields match everything; From and
+// To bound Finished inclusively.
+type ResultQuery struct {
+	Statuses []Status
+	From     time.Time
+	To       time.Time
+}
+
+func (q ResultQuery) matches(r StoredResult) bool {
+	if !q.From.IsZero() && r.Finished.Before(q.From) {
+		return false
+	}
+
+	if !q.To.IsZero() && r.Finished.After(q.To) {
+		return false
+	}
+
+	if len(q.Statuses) == 0 {
+		return true
+	}
+
+	for _, status := range q.Statuses {
+		if r.Status == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResultStore keeps job results addressable by JobID. Implementations must be
+// safe for concurrent use.
+type ResultStore interface {
+	Put(r StoredResult) error
+	Get(id JobID) (r StoredResult, ok bool, err error)
+	// Query returns matching results ordered by Finished.
+	Query(q ResultQuery) ([]StoredResult, error)
+	// Expire removes results finished before the given time and reports how
+	// many were removed.
+	Expire(before time.Time) (int, error)
+}
+
+// WithResultStore records the result of every job in store as it completes.
+func WithResultStore(store ResultStore) Option {
+	return func(s *Scheduler) {
+		s.store = store
+	}
+}
+
+type MemoryResultStore struct {
+	mu      sync.RWMutex
+	results map[JobID]StoredResult
+}
+
+func NewMemoryResultStore() *MemoryResultStore {
+	return &MemoryResultStore{
+		results: make(map[JobID]StoredResult),
+	}
+}
+
+func (m *MemoryResultStore) Put(r StoredResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.results[r.ID] = r
+	return nil
+}
+
+func (m *MemoryResultStore) Get(id JobID) (StoredResult, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.results[id]
+	return r, ok, nil
+}
+
+func (m *MemoryResultStore) Query(q ResultQuery) ([]StoredResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []StoredResult
+
+	for _, r := range m.results {
+		if q.matches(r) {
+			matched = append(matched, r)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Finished.Before(matched[j].Finished)
+	})
+
+	return matched, nil
+}
+
+func (m *MemoryResultStore) Expire(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+
+	for id, r := range m.results {
+		if r.Finished.Before(before) {
+			delete(m.results, id)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// FileResultStore is a MemoryResultStore backed by an append-only file, so a
+// later process can open the same path and look results up. Only one process
+// should write to a path at a time. Results come back whole, except that an
+// error is restored from its message, as it is from a Checkpoint.
+type FileResultStore struct {
+	mem  *MemoryResultStore
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+type storedRecord struct {
+	ID           JobID
+	Value        interface{}
+	Err          string
+	Status       Status
+	Finished     time.Time
+	ResultID     JobID
+	ResultStatus Status
+	Enqueued     time.Time
+	Started      time.Time
+	Ended        time.Time
+	Wait         time.Duration
+	Duration     time.Duration
+	Worker       int
+	Attempts     int
+}
+
+func newStoredRecord(r StoredResult) *storedRecord {
+	return &storedRecord{
+		ID:           r.ID,
+		Value:        r.Result.Value,
+		Err:          errorString(r.Result.Err),
+		Status:       r.Status,
+		Finished:     r.Finished,
+		ResultID:     r.Result.ID,
+		ResultStatus: r.Result.Status,
+		Enqueued:     r.Result.Enqueued,
+		Started:      r.Result.Started,
+		Ended:        r.Result.Ended,
+		Wait:         r.Result.Wait,
+		Duration:     r.Result.Duration,
+		Worker:       r.Result.Worker,
+		Attempts:     r.Result.Attempts,
+	}
+}
+
+func (record *storedRecord) stored() StoredResult {
+	return StoredResult{
+		ID: record.ID,
+		Result: Result{
+			Value:    record.Value,
+			Err:      restoreError(record.Err),
+			ID:       record.ResultID,
+			Status:   record.ResultStatus,
+			Enqueued: record.Enqueued,
+			Started:  record.Started,
+			Ended:    record.Ended,
+			Wait:     record.Wait,
+			Duration: record.Duration,
+			Worker:   record.Worker,
+			Attempts: record.Attempts,
+		},
+		Status:   record.Status,
+		Finished: record.Finished,
+	}
+}
+
+func OpenFileResultStore(path string) (*FileResultStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FileResultStore{
+		mem:  NewMemoryResultStore(),
+		path: path,
+		file: file,
+	}
+
+	if err := f.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *FileResultStore) load() error {
+	reader := bufio.NewReader(f.file)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var record storedRecord
+		if err := decodeLine(line, &record); err != nil {
+			break
+		}
+
+		f.mem.Put(record.stored())
+		offset += int64(len(line))
+	}
+
+	if err := f.file.Truncate(offset); err != nil {
+		return err
+	}
+
+	_, err := f.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (f *FileResultStore) Put(r StoredResult) error {
+	line, err := encodeLine(newStoredRecord(r))
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.file.Write(line); err != nil {
+		return err
+	}
+
+	return f.mem.Put(r)
+}
+
+func (f *FileResultStore) Get(id JobID) (StoredResult, bool, error) {
+	return f.mem.Get(id)
+}
+
+func (f *FileResultStore) Query(q ResultQuery) ([]StoredResult, error) {
+	return f.mem.Query(q)
+}
+
+// Expire compacts the file by rewriting the remaining results to a temporary
+// file that replaces the original, and only then drops old results from
+// memory, so a failed rewrite leaves the store as it was.
+func (f *FileResultStore) Expire(before time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	all, _ := f.mem.Query(ResultQuery{})
+	remaining := all[:0]
+
+	for _, r := range all {
+		if !r.Finished.Before(before) {
+			remaining = append(remaining, r)
+		}
+	}
+
+	removed := len(all) - len(remaining)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	tmp, err := os.Create(f.path + ".tmp")
+	if err != nil {
+		return 0, err
+	}
+
+	if err := writeRecords(tmp, remaining); err != nil {
+		os.Remove(f.path + ".tmp")
+		return 0, err
+	}
+
+	if err := os.Rename(f.path+".tmp", f.path); err != nil {
+		os.Remove(f.path + ".tmp")
+		return 0, err
+	}
+
+	// The file holds only the remaining results now, whether or not it can
+	// be reopened
+	f.mem.Expire(before)
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return removed, err
+	}
+
+	f.file.Close()
+	f.file = file
+
+	return removed, nil
+}
+
+// writeRecords writes results to file and closes it.
+func writeRecords(file *os.File, results []StoredResult) error {
+	writer := bufio.NewWriter(file)
+
+	for _, r := range results {
+		line, err := encodeLine(newStoredRecord(r))
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		writer.Write(line)
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (f *FileResultStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
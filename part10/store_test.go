@@ -0,0 +1,193 @@
+package part10_test
+
+import (
+	"errors"
+	"os"
+	. "part10"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_store_results_by_job_id(t *testing.T) {
+	store := NewMemoryResultStore()
+	s := NewScheduler(2, 1000*time.Millisecond, WithResultStore(store))
+
+	sum := s.Add(func() interface{} { return 6 })
+	panicker := s.Add(func() interface{} { panic("Something bad happened") })
+
+	if sum == panicker {
+		t.Fatalf("Wanted distinct job IDs, got %v twice", sum)
+	}
+
+	s.Run()
+
+	r, ok, err := store.Get(sum)
+	if err != nil || !ok {
+		t.Fatalf("Wanted stored result for %v, got %v %v", sum, ok, err)
+	}
+
+	if !reflect.DeepEqual(outcome(r.Result), Result{Value: 6}) || r.Status != Succeeded {
+		t.Errorf("Wanted 6 succeeded, got %v %v", r.Result, r.Status)
+	}
+
+	if r.Result.ID != sum || r.Result.Status != Succeeded || r.Result.Attempts != 1 || r.Result.Worker == 0 {
+		t.Errorf("Wanted the annotated result of %v, got %+v", sum, r.Result)
+	}
+
+	panicked, err := store.Query(ResultQuery{Statuses: []Status{Panicked}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(panicked) != 1 || panicked[0].ID != panicker {
+		t.Fatalf("Wanted only %v, got %v", panicker, panicked)
+	}
+
+	if !errors.Is(panicked[0].Result.Err, ErrPanicked) {
+		t.Errorf("Wanted %v, got %v", ErrPanicked, panicked[0].Result.Err)
+	}
+}
+
+func TestFileResultStore_should_survive_reopening_and_expire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+
+	store, err := OpenFileResultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScheduler(1, 1000*time.Millisecond, WithResultStore(store))
+	old := s.Add(func() interface{} { return 1 })
+	s.Run()
+
+	cutoff := time.Now()
+	time.Sleep(time.Millisecond)
+
+	recent := s.Add(func() interface{} { return "two" })
+	s.Run()
+	store.Close()
+
+	store, err = OpenFileResultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok, _ := store.Get(old); !ok || r.Result.Value != 1 {
+		t.Errorf("Wanted 1 for %v, got %v", old, r.Result.Value)
+	}
+
+	if r, ok, _ := store.Get(recent); !ok || r.Result.Value != "two" {
+		t.Errorf("Wanted two for %v, got %v", recent, r.Result.Value)
+	}
+
+	if inRange, _ := store.Query(ResultQuery{From: cutoff}); len(inRange) != 1 {
+		t.Errorf("Wanted 1 result after cutoff, got %v", len(inRange))
+	}
+
+	if removed, err := store.Expire(cutoff); removed != 1 || err != nil {
+		t.Errorf("Wanted 1 expired, got %v %v", removed, err)
+	}
+
+	store.Close()
+
+	store, err = OpenFileResultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, ok, _ := store.Get(old); ok {
+		t.Errorf("Wanted %v to be expired", old)
+	}
+
+	if _, ok, _ := store.Get(recent); !ok {
+		t.Errorf("Wanted %v to remain", recent)
+	}
+}
+
+func TestFileResultStore_should_keep_whole_results(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+
+	store, err := OpenFileResultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enqueued := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := StoredResult{
+		ID: "job-1",
+		Result: Result{
+			Value:    "done",
+			Err:      Timeout,
+			ID:       "job-1",
+			Status:   TimedOut,
+			Enqueued: enqueued,
+			Started:  enqueued.Add(time.Second),
+			Ended:    enqueued.Add(3 * time.Second),
+			Wait:     time.Second,
+			Duration: 2 * time.Second,
+			Worker:   3,
+			Attempts: 2,
+		},
+		Status:   TimedOut,
+		Finished: enqueued.Add(4 * time.Second),
+	}
+
+	if err := store.Put(want); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = OpenFileResultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	got, ok, err := store.Get(want.ID)
+	if err != nil || !ok {
+		t.Fatalf("Wanted stored result for %v, got %v %v", want.ID, ok, err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted %+v, got %+v", want, got)
+	}
+}
+
+func TestFileResultStore_should_keep_results_when_expiring_fails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+
+	store, err := OpenFileResultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	finished := time.Now()
+	store.Put(StoredResult{ID: "old", Result: Result{Value: 1}, Status: Succeeded, Finished: finished})
+
+	// The compacted file cannot be created over a directory
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := store.Expire(finished.Add(time.Second)); removed != 0 || err == nil {
+		t.Errorf("Wanted nothing expired and an error, got %v %v", removed, err)
+	}
+
+	if _, ok, _ := store.Get("old"); !ok {
+		t.Errorf("Wanted old to remain after a failed expiry")
+	}
+
+	os.Remove(path + ".tmp")
+
+	if removed, err := store.Expire(finished.Add(time.Second)); removed != 1 || err != nil {
+		t.Errorf("Wanted 1 expired, got %v %v", removed, err)
+	}
+
+	if _, ok, _ := store.Get("old"); ok {
+		t.Errorf("Wanted old to be expired")
+	}
+}
@@ -0,0 +1,164 @@
+package part10
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"time"
+)
+
+// Timeline records what every worker ran during a Run, one entry per attempt.
+// Workers counts every worker the Run started, at its start, on resizes or in
+// place of stuck workers, whether or not it ran anything.
+type Timeline struct {
+	Start   time.Time
+	End     time.Time
+	Workers int
+	Entries []TimelineEntry
+}
+
+type TimelineEntry struct {
+	ID      JobID
+	Attempt int
+	Worker  int
+	Start   time.Time
+	End     time.Time
+	Status  Status
+}
+
+// WithTimeline records a Timeline of every Run, available from Timeline once
+// the Run returns.
+func WithTimeline() Option {
+	return func(s *Scheduler) {
+		s.recordTimeline = true
+	}
+}
+
+// Timeline returns the Timeline of the last Run, or nil when not recording.
+func (s *Scheduler) Timeline() *Timeline {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.timeline
+}
+
+func (t *Timeline) add(j *job, c *jobCompletion) {
+	t.Entries = append(t.Entries, TimelineEntry{j.id, c.attempt, c.worker, c.start, c.end, statusOf(&c.result)})
+}
+
+type traceEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Phase string                 `json:"ph"`
+	TS    float64                `json:"ts"`
+	Dur   float64                `json:"dur,omitempty"`
+	PID   int                    `json:"pid"`
+	TID   int                    `json:"tid"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// WriteChromeTrace writes t in the Chrome trace_event JSON format, viewable in
+// chrome://tracing or Perfetto, with a thread per worker.
+func (t *Timeline) WriteChromeTrace(w io.Writer) error {
+	events := make([]traceEvent, 0, t.Workers+len(t.Entries))
+
+	for worker := 1; worker <= t.Workers; worker++ {
+		events = append(events, traceEvent{
+			Name:  "thread_name",
+			Phase: "M",
+			PID:   1,
+			TID:   worker,
+			Args:  map[string]interface{}{"name": fmt.Sprintf("worker %d", worker)},
+		})
+	}
+
+	for _, entry := range t.Entries {
+		events = append(events, traceEvent{
+			Name:  string(entry.ID),
+			Cat:   entry.Status.String(),
+			Phase: "X",
+			TS:    micros(entry.Start.Sub(t.Start)),
+			Dur:   micros(entry.End.Sub(entry.Start)),
+			PID:   1,
+			TID:   entry.Worker,
+			Args:  map[string]interface{}{"attempt": entry.Attempt, "status": entry.Status.String()},
+		})
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+var ganttColors = map[Status]string{
+	Succeeded: "#4caf50",
+	Failed:    "#ff9800",
+	TimedOut:  "#f44336",
+	Panicked:  "#9c27b0",
+	Cancelled: "#607d8b",
+	Skipped:   "#9e9e9e",
+	Expired:   "#795548",
+}
+
+const (
+	ganttWidth  = 1000
+	ganttLabel  = 80
+	ganttRow    = 24
+	ganttTicks  = 10
+	ganttHeader = 20
+)
+
+// WriteGantt writes t as a self-contained HTML page with an SVG Gantt chart: a
+// row per worker and a bar per attempt, coloured by status, with the job ID,
+// attempt and duration on hover.
+func (t *Timeline) WriteGantt(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	total := t.End.Sub(t.Start)
+	if total <= 0 {
+		total = 1
+	}
+	scale := float64(ganttWidth) / float64(total)
+	height := ganttHeader + t.Workers*ganttRow
+
+	fmt.Fprintf(b, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>Run timeline</title></head>\n<body style=\"font-family: sans-serif\">\n")
+	fmt.Fprintf(b, "<p>%d attempts on %d workers in %v</p>\n", len(t.Entries), t.Workers, total)
+	fmt.Fprintf(b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-size=\"11\">\n", ganttLabel+ganttWidth+40, height)
+
+	for i := 0; i <= ganttTicks; i++ {
+		x := ganttLabel + i*ganttWidth/ganttTicks
+		fmt.Fprintf(b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#ddd\"/>\n", x, ganttHeader-4, x, height)
+		fmt.Fprintf(b, "<text x=\"%d\" y=\"12\" text-anchor=\"middle\">%v</text>\n", x, (total * time.Duration(i) / ganttTicks).Round(time.Microsecond))
+	}
+
+	for worker := 1; worker <= t.Workers; worker++ {
+		fmt.Fprintf(b, "<text x=\"0\" y=\"%d\">worker %d</text>\n", ganttHeader+(worker-1)*ganttRow+16, worker)
+	}
+
+	for _, entry := range t.Entries {
+		x := float64(ganttLabel) + float64(entry.Start.Sub(t.Start))*scale
+		width := float64(entry.End.Sub(entry.Start)) * scale
+		if width < 1 {
+			width = 1
+		}
+
+		fmt.Fprintf(b, "<rect x=\"%.2f\" y=\"%d\" width=\"%.2f\" height=\"%d\" fill=\"%s\"><title>%s attempt %d: %v in %v</title></rect>\n",
+			x, ganttHeader+(entry.Worker-1)*ganttRow+2, width, ganttRow-4, ganttColors[entry.Status],
+			html.EscapeString(string(entry.ID)), entry.Attempt, entry.Status, entry.End.Sub(entry.Start))
+	}
+
+	fmt.Fprintf(b, "</svg>\n<p>")
+	for status := Succeeded; status <= Expired; status++ {
+		fmt.Fprintf(b, "<span style=\"color: %s\">&#9632;</span> %v ", ganttColors[status], status)
+	}
+	fmt.Fprintf(b, "</p>\n</body>\n</html>\n")
+
+	return b.Flush()
+}
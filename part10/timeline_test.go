@@ -0,0 +1,144 @@
+package part10_test
+
+import (
+	"bytes"
+	"encoding/json"
+	. "part10"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_record_a_timeline(t *testing.T) {
+	s := NewScheduler(2, 20*time.Millisecond, WithTimeline())
+
+	release := make(chan struct{})
+	defer close(release)
+
+	s.Add(constant(1))
+	s.Add(constant(2))
+	s.Add(func() interface{} { panic("Something bad happened") })
+	timedOut := s.Add(func() interface{} {
+		<-release
+		return nil
+	})
+
+	s.Run()
+
+	timeline := s.Timeline()
+	if timeline == nil || len(timeline.Entries) != 4 || timeline.Workers != 2 {
+		t.Fatalf("Wanted 4 entries on 2 workers, got %+v", timeline)
+	}
+
+	for _, entry := range timeline.Entries {
+		if entry.Start.Before(timeline.Start) || entry.End.After(timeline.End) || entry.Worker < 1 {
+			t.Errorf("Wanted the entry within the Run on a worker, got %+v", entry)
+		}
+
+		if entry.ID == timedOut && (entry.Status != TimedOut || entry.End.Sub(entry.Start) < 20*time.Millisecond) {
+			t.Errorf("Wanted a timeout after 20ms, got %+v", entry)
+		}
+	}
+
+	if NewScheduler(1, 0).Timeline() != nil {
+		t.Errorf("Wanted no timeline unless recording")
+	}
+}
+
+func TestScheduler_should_keep_timeline_rows_for_idle_workers(t *testing.T) {
+	s := NewScheduler(4, 0, WithTimeline())
+
+	s.Add(func() interface{} {
+		s.Resize(6)
+		return nil
+	})
+
+	s.Run()
+
+	timeline := s.Timeline()
+	if timeline.Workers != 6 || len(timeline.Entries) != 1 {
+		t.Fatalf("Wanted 1 entry on 6 workers, got %+v", timeline)
+	}
+
+	var gantt bytes.Buffer
+	if err := timeline.WriteGantt(&gantt); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(gantt.String(), ">worker 6<") {
+		t.Errorf("Wanted a row for worker 6, got %v", gantt.String())
+	}
+}
+
+func testTimeline() *Timeline {
+	start := time.Unix(0, 0)
+
+	return &Timeline{
+		Start:   start,
+		End:     start.Add(30 * time.Millisecond),
+		Workers: 2,
+		Entries: []TimelineEntry{
+			{"a-1", 1, 1, start, start.Add(10 * time.Millisecond), Succeeded},
+			{"a-2", 1, 2, start.Add(time.Millisecond), start.Add(30 * time.Millisecond), TimedOut},
+			{"<a-3>", 2, 1, start.Add(10 * time.Millisecond), start.Add(12 * time.Millisecond), Panicked},
+		},
+	}
+}
+
+func TestTimeline_should_export_chrome_trace_events(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testTimeline().WriteChromeTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var trace struct {
+		TraceEvents []struct {
+			Name string
+			Ph   string
+			Ts   float64
+			Dur  float64
+			Tid  int
+			Args map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatalf("Wanted JSON, got %v: %s", err, buf.Bytes())
+	}
+
+	if len(trace.TraceEvents) != 5 {
+		t.Fatalf("Wanted 2 thread names and 3 jobs, got %+v", trace.TraceEvents)
+	}
+
+	if names := trace.TraceEvents[1]; names.Ph != "M" || names.Tid != 2 || names.Args["name"] != "worker 2" {
+		t.Errorf("Wanted worker 2 named, got %+v", names)
+	}
+
+	if job := trace.TraceEvents[3]; job.Ph != "X" || job.Name != "a-2" || job.Ts != 1000 || job.Dur != 29000 || job.Tid != 2 || job.Args["status"] != "timed_out" {
+		t.Errorf("Wanted a complete event for a-2, got %+v", job)
+	}
+}
+
+func TestTimeline_should_export_an_svg_gantt_chart(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testTimeline().WriteGantt(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	page := buf.String()
+
+	for _, expected := range []string{
+		"<!DOCTYPE html>",
+		"<svg",
+		"worker 2</text>",
+		`<rect x="113.33" y="46" width="966.67" height="20" fill="#f44336"><title>a-2 attempt 1: timed_out in 29ms</title></rect>`,
+		"&lt;a-3&gt; attempt 2",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Wanted %q in\n%v", expected, page)
+		}
+	}
+
+	if rects := strings.Count(page, "<rect"); rects != 3 {
+		t.Errorf("Wanted 3 bars, got %v", rects)
+	}
+}
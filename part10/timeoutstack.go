@@ -0,0 +1,97 @@
+package part10
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutError is the error of a job that outlived its timeout on a scheduler
+// WithTimeoutStacks. It unwraps to Timeout, so errors.Is(err, Timeout) holds.
+type TimeoutError struct {
+	Elapsed time.Duration
+	Limit   time.Duration
+	// Stack is the job goroutine's stack when the timeout fired, in the format
+	// of runtime.Stack, or empty if the goroutine had not started yet.
+	Stack string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v after %v (limit %v)", Timeout, e.Elapsed, e.Limit)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return Timeout
+}
+
+// WithTimeoutStacks reports timeouts as a *TimeoutError holding the stack of
+// the goroutine still running the job. Capturing it stops the world to dump
+// every goroutine, so it costs more the more goroutines there are.
+func WithTimeoutStacks() Option {
+	return func(s *Scheduler) {
+		s.timeoutStacks = true
+	}
+}
+
+// goroutineID parses the current goroutine's ID from its stack header,
+// "goroutine 18 [running]:".
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+
+	if i := bytes.IndexByte(buf, ' '); i >= 0 {
+		id, _ := strconv.ParseUint(string(buf[:i]), 10, 64)
+		return id
+	}
+
+	return 0
+}
+
+// goroutineStack picks the stack of goroutine id out of a dump of all of them.
+func goroutineStack(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+
+	header := []byte("goroutine " + strconv.FormatUint(id, 10) + " [")
+	for _, stack := range bytes.Split(allStacks(), []byte("\n\n")) {
+		if bytes.HasPrefix(stack, header) {
+			return string(stack)
+		}
+	}
+
+	return ""
+}
+
+// allStacks dumps every goroutine's stack.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// timeoutError builds the error of a job timing out after start, by the
+// wheel's clock, with the stack of the goroutine whose ID is stored in id when
+// capturing stacks.
+func (w *worker) timeoutError(start time.Time, id *uint64) error {
+	if !w.timeoutStacks {
+		return Timeout
+	}
+
+	return &TimeoutError{
+		Elapsed: w.wheel.clock.Now().Sub(start),
+		Limit:   w.timeout,
+		Stack:   goroutineStack(atomic.LoadUint64(id)),
+	}
+}
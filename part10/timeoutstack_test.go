@@ -0,0 +1,51 @@
+package part10_test
+
+import (
+	"errors"
+	. "part10"
+	"strings"
+	"testing"
+	"time"
+)
+
+func stuckInReceive(release chan struct{}) interface{} {
+	<-release
+	return 1
+}
+
+func TestScheduler_should_capture_the_stack_of_timed_out_jobs(t *testing.T) {
+	s := NewScheduler(2, 20*time.Millisecond, WithTimeoutStacks())
+
+	release := make(chan struct{})
+	defer close(release)
+
+	s.Add(func() interface{} {
+		return stuckInReceive(release)
+	})
+	s.Add(func() interface{} {
+		return 2
+	})
+
+	actual := s.Run()
+
+	var timeout *TimeoutError
+	if !errors.As(actual[0].Err, &timeout) || !errors.Is(actual[0].Err, Timeout) {
+		t.Fatalf("Wanted a TimeoutError wrapping %v, got %v", Timeout, actual[0].Err)
+	}
+
+	if timeout.Limit != 20*time.Millisecond || timeout.Elapsed < timeout.Limit {
+		t.Errorf("Wanted at least %v elapsed of a %v limit, got %v of %v", 20*time.Millisecond, 20*time.Millisecond, timeout.Elapsed, timeout.Limit)
+	}
+
+	if !strings.HasPrefix(timeout.Stack, "goroutine ") || !strings.Contains(timeout.Stack, "stuckInReceive") {
+		t.Errorf("Wanted the stack of the stuck job, got %q", timeout.Stack)
+	}
+
+	if strings.Contains(timeout.Stack, "\ngoroutine ") {
+		t.Errorf("Wanted a single goroutine's stack, got %q", timeout.Stack)
+	}
+
+	if actual[1].Value != 2 || actual[1].Err != nil {
+		t.Errorf("Wanted %v, got %v", Result{Value: 2}, actual[1])
+	}
+}
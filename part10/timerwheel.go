@@ -0,0 +1,279 @@
+package part10
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source of a TimerWheel and of the timestamps a Scheduler
+// puts on jobs. Tests inject a fake clock to drive timeouts, retries and delays
+// deterministically.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+// epoch anchors realClock, which then only reads the monotonic clock. That
+// costs half as much as time.Now and gives the same monotonic reading, with
+// the wall time offset from epoch's.
+var epoch = time.Now()
+
+func (realClock) Now() time.Time {
+	return epoch.Add(time.Since(epoch))
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+const (
+	wheelBits   = 6
+	wheelSize   = 1 << wheelBits
+	wheelMask   = wheelSize - 1
+	wheelLevels = 6
+
+	DefaultTickResolution = time.Millisecond
+)
+
+// TimerWheel is a hashed hierarchical timer wheel. Level 0 has a slot per
+// tick and every further level a slot per full turn of the level below, so six
+// levels of 64 slots cover 2^36 ticks. Timers cascade down a level as their
+// slot comes up and fire from level 0, all from one goroutine, which replaces
+// a runtime timer per job with an allocation-free list insert.
+type TimerWheel struct {
+	mu         sync.Mutex
+	clock      Clock
+	resolution time.Duration
+	start      time.Time
+	now        uint64
+	levels     [wheelLevels][wheelSize]*WheelTimer
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// WheelTimer is a timer armed on a TimerWheel. It either signals fire, which
+// needs a buffer of one, or calls fn on the wheel goroutine.
+type WheelTimer struct {
+	wheel      *TimerWheel
+	fire       chan struct{}
+	fn         func()
+	expiry     uint64
+	level      int
+	slot       int
+	prev, next *WheelTimer
+	active     bool
+}
+
+// NewTimerWheel starts a wheel advancing every resolution of clock. A nil
+// clock uses the real time and a resolution <= 0 DefaultTickResolution.
+func NewTimerWheel(clock Clock, resolution time.Duration) *TimerWheel {
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	if resolution <= 0 {
+		resolution = DefaultTickResolution
+	}
+
+	w := &TimerWheel{
+		clock:      clock,
+		resolution: resolution,
+		start:      clock.Now(),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	ticker := clock.NewTicker(resolution)
+	go w.run(ticker)
+
+	return w
+}
+
+func (w *TimerWheel) run(ticker Ticker) {
+	defer close(w.done)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C():
+			w.advanceTo(now)
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// AfterFunc calls f on the wheel goroutine once d has passed, rounded up to
+// the wheel's resolution. f must not block.
+func (w *TimerWheel) AfterFunc(d time.Duration, f func()) *WheelTimer {
+	t := &WheelTimer{wheel: w, fn: f}
+	w.arm(t, d)
+
+	return t
+}
+
+// Stop disarms t, reporting false if it already fired or was stopped.
+func (t *WheelTimer) Stop() bool {
+	return t.wheel.cancel(t)
+}
+
+// Stop ends the wheel goroutine; pending timers never fire. Stop is a no-op on
+// a nil wheel.
+func (w *TimerWheel) Stop() {
+	if w == nil {
+		return
+	}
+
+	close(w.stop)
+	<-w.done
+}
+
+func (w *TimerWheel) ticks(at time.Time) uint64 {
+	if elapsed := at.Sub(w.start); elapsed > 0 {
+		return uint64(elapsed / w.resolution)
+	}
+
+	return 0
+}
+
+// arm schedules t to expire d from now. A reusable timer may be armed again
+// once it fired or was cancelled.
+func (w *TimerWheel) arm(t *WheelTimer, d time.Duration) {
+	t.wheel = w
+	deadline := w.clock.Now().Add(d + w.resolution - 1)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	t.expiry = w.ticks(deadline)
+	if t.expiry <= w.now {
+		t.expiry = w.now + 1
+	}
+
+	w.insert(t)
+}
+
+// cancel disarms t, reporting false if it already fired. A fired timer has
+// always delivered its fire signal by the time cancel returns.
+func (w *TimerWheel) cancel(t *WheelTimer) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !t.active {
+		return false
+	}
+
+	w.unlink(t)
+	return true
+}
+
+// insert places t on the lowest level whose slots still tell its expiry apart
+// from now. Timers beyond the top level park in its furthest slot and are
+// placed again when it cascades.
+func (w *TimerWheel) insert(t *WheelTimer) {
+	level := 0
+	for ; level < wheelLevels-1; level++ {
+		shift := uint(wheelBits * level)
+		if (t.expiry>>shift)-(w.now>>shift) < wheelSize {
+			break
+		}
+	}
+
+	shift := uint(wheelBits * level)
+	if (t.expiry>>shift)-(w.now>>shift) < wheelSize {
+		t.slot = int(t.expiry>>shift) & wheelMask
+	} else {
+		t.slot = int((w.now>>shift)-1) & wheelMask
+	}
+
+	t.level = level
+	t.prev, t.next = nil, w.levels[level][t.slot]
+	if t.next != nil {
+		t.next.prev = t
+	}
+	w.levels[level][t.slot] = t
+	t.active = true
+}
+
+func (w *TimerWheel) unlink(t *WheelTimer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.levels[t.level][t.slot] = t.next
+	}
+
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+
+	t.prev, t.next, t.active = nil, nil, false
+}
+
+// advanceTo processes every tick up to now, then runs the callbacks of fired
+// timers outside the lock.
+func (w *TimerWheel) advanceTo(now time.Time) {
+	var fired []func()
+
+	w.mu.Lock()
+	for target := w.ticks(now); w.now < target; {
+		w.now++
+
+		for level := 1; level < wheelLevels; level++ {
+			shift := uint(wheelBits * level)
+			if w.now&(1<<shift-1) != 0 {
+				break
+			}
+
+			slot := int(w.now>>shift) & wheelMask
+			t := w.levels[level][slot]
+			w.levels[level][slot] = nil
+
+			for t != nil {
+				next := t.next
+				t.prev, t.next = nil, nil
+				w.insert(t)
+				t = next
+			}
+		}
+
+		slot := int(w.now) & wheelMask
+		for t := w.levels[0][slot]; t != nil; {
+			next := t.next
+
+			if t.expiry <= w.now {
+				w.unlink(t)
+
+				if t.fn != nil {
+					fired = append(fired, t.fn)
+				} else {
+					select {
+					case t.fire <- struct{}{}:
+					default:
+					}
+				}
+			}
+
+			t = next
+		}
+	}
+	w.mu.Unlock()
+
+	for _, f := range fired {
+		f()
+	}
+}
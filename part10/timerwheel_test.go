@@ -0,0 +1,270 @@
+package part10_test
+
+import (
+	. "part10"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when advanced. Every advance is delivered to the wheel
+// twice, so it returns only after the wheel has processed it.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	c       chan time.Time
+	stopped chan struct{}
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	close(t.stopped)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTicker{make(chan time.Time), make(chan struct{})}
+	c.tickers = append(c.tickers, t)
+
+	return t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now, tickers := c.now, c.tickers
+	c.mu.Unlock()
+
+	for _, t := range tickers {
+		for i := 0; i < 2; i++ {
+			select {
+			case t.c <- now:
+			case <-t.stopped:
+			}
+		}
+	}
+}
+
+func TestTimerWheel_should_fire_after_the_delay(t *testing.T) {
+	clock := newFakeClock()
+	wheel := NewTimerWheel(clock, time.Millisecond)
+	defer wheel.Stop()
+
+	var mu sync.Mutex
+	var fired []time.Duration
+
+	for _, d := range []time.Duration{3 * time.Millisecond, 100 * time.Millisecond, 5 * time.Second, 2 * time.Hour} {
+		d := d
+		wheel.AfterFunc(d, func() {
+			mu.Lock()
+			fired = append(fired, d)
+			mu.Unlock()
+		})
+	}
+
+	expectFired := func(n int) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(fired) != n {
+			t.Fatalf("At %v wanted %v timers fired, got %v", clock.Now().Sub(time.Unix(0, 0)), n, fired)
+		}
+	}
+
+	clock.Advance(2 * time.Millisecond)
+	expectFired(0)
+
+	clock.Advance(time.Millisecond)
+	expectFired(1)
+
+	clock.Advance(96 * time.Millisecond)
+	expectFired(1)
+
+	clock.Advance(time.Millisecond)
+	expectFired(2)
+
+	clock.Advance(4900*time.Millisecond - time.Millisecond)
+	expectFired(2)
+
+	clock.Advance(time.Millisecond)
+	expectFired(3)
+
+	clock.Advance(2*time.Hour - 5*time.Second - time.Millisecond)
+	expectFired(3)
+
+	clock.Advance(time.Millisecond)
+	expectFired(4)
+}
+
+func TestTimerWheel_should_not_fire_stopped_timers(t *testing.T) {
+	clock := newFakeClock()
+	wheel := NewTimerWheel(clock, 10*time.Millisecond)
+	defer wheel.Stop()
+
+	fired := false
+	timer := wheel.AfterFunc(15*time.Millisecond, func() { fired = true })
+
+	if !timer.Stop() {
+		t.Errorf("Wanted Stop to disarm the timer")
+	}
+
+	clock.Advance(time.Second)
+
+	if fired || timer.Stop() {
+		t.Errorf("Wanted the stopped timer not to fire")
+	}
+}
+
+// runWithClock runs s while advancing clock in steps until Run returns.
+func runWithClock(s *Scheduler, clock *fakeClock, step time.Duration) []Result {
+	done := make(chan []Result)
+	go func() {
+		done <- s.Run()
+	}()
+
+	for {
+		select {
+		case results := <-done:
+			return results
+		case <-time.After(time.Millisecond):
+			clock.Advance(step)
+		}
+	}
+}
+
+func TestScheduler_should_time_out_by_the_injected_clock(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(1, time.Hour, WithClock(clock))
+
+	release := make(chan struct{})
+	defer close(release)
+
+	s.Add(func() interface{} {
+		<-release
+		return 1
+	})
+
+	actual := runWithClock(s, clock, 10*time.Minute)
+
+	if actual[0].Err != Timeout {
+		t.Errorf("Wanted %v, got %v", Timeout, actual[0].Err)
+	}
+
+	if elapsed := clock.Now().Sub(time.Unix(0, 0)); elapsed < time.Hour {
+		t.Errorf("Wanted the timeout after an hour, got %v", elapsed)
+	}
+}
+
+func TestScheduler_should_retry_with_backoff(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(1, 0, WithClock(clock), WithRetry(2, time.Second))
+
+	var attempts []time.Time
+	s.Add(func() interface{} {
+		attempts = append(attempts, clock.Now())
+		if len(attempts) < 3 {
+			panic("Something bad happened")
+		}
+
+		return len(attempts)
+	})
+
+	actual := runWithClock(s, clock, 100*time.Millisecond)
+
+	if actual[0].Value != 3 || actual[0].Err != nil {
+		t.Fatalf("Wanted success on the third attempt, got %v", actual[0])
+	}
+
+	if gap := attempts[1].Sub(attempts[0]); gap < time.Second {
+		t.Errorf("Wanted at least 1s before the first retry, got %v", gap)
+	}
+
+	if gap := attempts[2].Sub(attempts[1]); gap < 2*time.Second {
+		t.Errorf("Wanted at least 2s before the second retry, got %v", gap)
+	}
+}
+
+func TestScheduler_should_report_the_last_failed_attempt(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(1, 0, WithClock(clock), WithRetry(1, time.Second))
+
+	calls := 0
+	s.Add(func() interface{} {
+		calls++
+		panic("Something bad happened")
+	})
+
+	actual := runWithClock(s, clock, 100*time.Millisecond)
+
+	if actual[0].Err == nil || calls != 2 {
+		t.Errorf("Wanted a failure after 2 calls, got %v after %v", actual[0], calls)
+	}
+}
+
+func TestScheduler_should_not_retry_shared_results(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(2, 0, WithClock(clock), WithRetry(1, time.Second))
+
+	var calls int32
+	f := func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		panic("Something bad happened")
+	}
+	s.AddKeyed("k", f)
+	s.AddKeyed("k", f)
+
+	actual := runWithClock(s, clock, 100*time.Millisecond)
+
+	if actual[0].Err == nil || actual[1].Err == nil || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("Wanted both to fail after 2 calls, got %v after %v", actual, atomic.LoadInt32(&calls))
+	}
+}
+
+func TestScheduler_should_delay_jobs(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(2, 0, WithClock(clock), WithTickResolution(time.Second))
+
+	var ranAt time.Time
+	s.AddAfter(time.Minute, func() interface{} {
+		ranAt = clock.Now()
+		return "late"
+	})
+	s.Add(func() interface{} { return "now" })
+
+	actual := runWithClock(s, clock, 10*time.Second)
+
+	if actual[0].Value != "late" || actual[1].Value != "now" {
+		t.Errorf("Wanted [late now], got %v", actual)
+	}
+
+	if elapsed := ranAt.Sub(time.Unix(0, 0)); elapsed < time.Minute {
+		t.Errorf("Wanted the job to run after a minute, got %v", elapsed)
+	}
+
+	// The delayed job waits in the queue from its release, by the same clock
+	if wait := s.MetricsSnapshot().QueueWait; wait.Count != 2 || wait.Sum < 0 || wait.Sum > 20*time.Second {
+		t.Errorf("Wanted the queue wait since release, got %+v", wait)
+	}
+}
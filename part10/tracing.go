@@ -0,0 +1,216 @@
+package part10
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanContext identifies a span within a trace, as carried by the W3C
+// traceparent header.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// Span is a finished span, ready for export.
+type Span struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	ParentID   [8]byte
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Err        error
+}
+
+// Attribute is a span attribute with a string or int value.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanExporter sends finished spans to a tracing backend.
+type SpanExporter interface {
+	ExportSpans(spans []Span) error
+}
+
+var ErrTraceparent = errors.New("malformed traceparent")
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc as the current span.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the current span carried by ctx.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// ParseTraceparent parses a W3C traceparent header such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(header string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, ErrTraceparent
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc, ErrTraceparent
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrTraceparent
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrTraceparent
+	}
+
+	if sc.TraceID == ([16]byte{}) || sc.SpanID == ([8]byte{}) {
+		return sc, ErrTraceparent
+	}
+
+	return sc, nil
+}
+
+// Traceparent formats sc as a sampled W3C traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-01"
+}
+
+// WithTracing records a span per job, from submission to its final result,
+// with a child span per attempt for its queue wait and one for its execution.
+// Jobs submitted with AddContext join the trace of the span the context
+// carries, and middleware sees the submitter's context values with the
+// execution span as the current span. Each Run exports its spans before
+// returning; an export failure is reported by Err.
+func WithTracing(exporter SpanExporter) Option {
+	return func(s *Scheduler) {
+		s.tracer = &tracer{exporter: exporter}
+	}
+}
+
+type tracer struct {
+	exporter SpanExporter
+	mu       sync.Mutex
+	spans    []Span
+}
+
+func (t *tracer) record(span Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = append(t.spans, span)
+}
+
+func (t *tracer) flush() error {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	return t.exporter.ExportSpans(spans)
+}
+
+// jobTrace is a traced job's span and the span it was submitted under. Jobs
+// only carry one while a tracer is configured.
+type jobTrace struct {
+	span   SpanContext
+	parent [8]byte
+}
+
+// start assigns j its job span, a child of the span carried by ctx if any.
+func (t *tracer) start(ctx context.Context, j *job) {
+	parent, ok := SpanContextFromContext(ctx)
+	if !ok {
+		randomID(parent.TraceID[:])
+	}
+
+	j.trace = &jobTrace{SpanContext{parent.TraceID, newSpanID()}, parent.SpanID}
+}
+
+func newSpanID() (id [8]byte) {
+	randomID(id[:])
+	return id
+}
+
+// randomID fills id from crypto/rand, falling back to the clock so that it is
+// never all zeros, which traceparent reserves as invalid.
+func randomID(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		binary.BigEndian.PutUint64(id[len(id)-8:], uint64(time.Now().UnixNano()))
+	}
+}
+
+func (t *tracer) jobSpan(j *job, c *jobCompletion) {
+	end := c.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	t.record(Span{
+		TraceID:    j.trace.span.TraceID,
+		SpanID:     j.trace.span.SpanID,
+		ParentID:   j.trace.parent,
+		Name:       "part10.job",
+		Start:      j.queued,
+		End:        end,
+		Attributes: []Attribute{{"job.id", string(j.id)}, {"job.attempts", c.attempt}},
+		Err:        c.result.Err,
+	})
+}
+
+func (t *tracer) attemptSpan(name string, r jobRequest, worker int, id [8]byte, start, end time.Time, err error) {
+	t.record(Span{
+		TraceID:    r.trace.span.TraceID,
+		SpanID:     id,
+		ParentID:   r.trace.span.SpanID,
+		Name:       name,
+		Start:      start,
+		End:        end,
+		Attributes: []Attribute{{"job.id", string(r.id)}, {"job.attempt", r.attempt}, {"job.worker", worker}},
+		Err:        err,
+	})
+}
+
+// valuesOnly carries the values of a submitter's context into the job without
+// its deadline or cancellation.
+type valuesOnly struct {
+	context.Context
+}
+
+func (valuesOnly) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (valuesOnly) Done() <-chan struct{} {
+	return nil
+}
+
+func (valuesOnly) Err() error {
+	return nil
+}
+
+func (j job) context() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+
+	return j.ctx
+}
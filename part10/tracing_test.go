@@ -0,0 +1,115 @@
+package part10_test
+
+import (
+	"context"
+	"errors"
+	. "part10"
+	"testing"
+)
+
+type spanRecorder struct {
+	spans []Span
+	err   error
+}
+
+func (r *spanRecorder) ExportSpans(spans []Span) error {
+	r.spans = append(r.spans, spans...)
+	return r.err
+}
+
+func TestParseTraceparent_should_round_trip(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceparent(header)
+	if err != nil || sc.Traceparent() != header {
+		t.Errorf("Wanted %v, got %v (%v)", header, sc.Traceparent(), err)
+	}
+
+	for _, malformed := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-zzf067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(malformed); err != ErrTraceparent {
+			t.Errorf("Wanted %v for %q, got %v", ErrTraceparent, malformed, err)
+		}
+	}
+}
+
+type userKey struct{}
+
+func TestScheduler_should_carry_the_trace_across_the_queue(t *testing.T) {
+	recorder := &spanRecorder{}
+	submitter, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	seen := make(map[JobID]context.Context)
+	s := NewScheduler(1, 0, WithTracing(recorder), WithMiddleware(func(next Handler) Handler {
+		return func(ctx context.Context, call Call) Result {
+			seen[call.ID] = ctx
+			return next(ctx, call)
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(ContextWithSpanContext(context.WithValue(context.Background(), userKey{}, "alice"), submitter))
+	id, _ := s.AddContext(ctx, constant(1))
+	cancel()
+
+	s.Add(func() interface{} { panic("Something bad happened") })
+
+	s.Run()
+
+	if ctx := seen[id]; ctx.Value(userKey{}) != "alice" || ctx.Err() != nil {
+		t.Errorf("Wanted the submitter's values without its cancellation, got %v, %v", seen[id].Value(userKey{}), seen[id].Err())
+	}
+
+	spans := make(map[string]Span)
+	for _, span := range recorder.spans {
+		if span.TraceID == submitter.TraceID {
+			spans[span.Name] = span
+		}
+	}
+
+	if len(recorder.spans) != 6 || len(spans) != 3 {
+		t.Fatalf("Wanted 3 spans per job, got %+v", recorder.spans)
+	}
+
+	job, queueWait, execute := spans["part10.job"], spans["part10.queue_wait"], spans["part10.execute"]
+
+	if job.ParentID != submitter.SpanID || job.Attributes[0] != (Attribute{"job.id", string(id)}) {
+		t.Errorf("Wanted the job span under the submitter's span, got %+v", job)
+	}
+
+	if queueWait.ParentID != job.SpanID || execute.ParentID != job.SpanID {
+		t.Errorf("Wanted the attempt spans under the job span, got %+v and %+v", queueWait, execute)
+	}
+
+	if queueWait.End.After(execute.Start) || job.Start.After(queueWait.Start) || execute.End.After(job.End) {
+		t.Errorf("Wanted the queue wait before the execution within the job, got %+v", spans)
+	}
+
+	if current, ok := SpanContextFromContext(seen[id]); !ok || current != (SpanContext{submitter.TraceID, execute.SpanID}) {
+		t.Errorf("Wanted the execution span as the current span, got %v", current)
+	}
+
+	for _, span := range recorder.spans {
+		if span.TraceID != submitter.TraceID && span.Name == "part10.execute" && !errors.Is(span.Err, ErrPanicked) {
+			t.Errorf("Wanted the panic recorded on its own trace, got %+v", span)
+		}
+	}
+}
+
+func TestScheduler_should_report_export_failures(t *testing.T) {
+	errExport := errors.New("Collector down")
+	s := NewScheduler(1, 0, WithTracing(&spanRecorder{err: errExport}))
+	s.Add(constant(1))
+
+	if actual := s.Run(); actual[0].Value != 1 {
+		t.Errorf("Wanted 1, got %v", actual[0])
+	}
+
+	if s.Err() != errExport {
+		t.Errorf("Wanted %v, got %v", errExport, s.Err())
+	}
+}
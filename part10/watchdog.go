@@ -0,0 +1,415 @@
+package part10
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Watchdog configures a background check on the workers of every Run. A
+// worker is stuck once it has spent Threshold running the same job, or
+// reporting results the Run is not collecting; a Run is stalled once it has
+// neither dispatched nor collected anything for Threshold while work is
+// outstanding.
+type Watchdog struct {
+	// Threshold is a minute when 0.
+	Threshold time.Duration
+	// Interval between checks, Threshold/4 when 0.
+	Interval time.Duration
+	// Replace starts a new worker in place of each worker stuck running a
+	// job, so the pool keeps its capacity, and dispatches anew the jobs queued
+	// behind it in its batch. The stuck worker still reports its job and then
+	// exits.
+	Replace bool
+	// OnStuck runs on the watchdog goroutine whenever a check finds a worker
+	// newly stuck or the Run newly stalled.
+	OnStuck func(WatchdogReport)
+}
+
+type Health int
+
+const (
+	Healthy Health = iota
+	Degraded
+	Stalled
+)
+
+var healthNames = map[Health]string{
+	Healthy:  "healthy",
+	Degraded: "degraded",
+	Stalled:  "stalled",
+}
+
+func (h Health) String() string {
+	if name, ok := healthNames[h]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+func (h Health) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+type WorkerPhase int
+
+const (
+	PhaseIdle WorkerPhase = iota
+	PhaseRunning
+	PhaseReporting
+	phaseExited
+)
+
+var phaseNames = map[WorkerPhase]string{
+	PhaseIdle:      "idle",
+	PhaseRunning:   "running",
+	PhaseReporting: "reporting",
+}
+
+func (p WorkerPhase) String() string {
+	if name, ok := phaseNames[p]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+func (p WorkerPhase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// HealthStatus is the outcome of the latest watchdog checks. Degraded means
+// some workers are stuck while the Runs still progress; Stalled that a Run
+// stopped progressing.
+type HealthStatus struct {
+	Health       Health
+	Checked      time.Time
+	LastProgress time.Time
+	Stuck        []StuckWorker
+	// Replaced counts the workers replaced since the scheduler was created.
+	Replaced int
+}
+
+// StuckWorker is a worker that has been in Phase since Since. Job and Attempt
+// are those of the job it runs, empty while reporting. Stack is the worker
+// goroutine's stack when the worker was found stuck.
+type StuckWorker struct {
+	Worker   int
+	Phase    WorkerPhase
+	Job      JobID
+	Attempt  int
+	Since    time.Time
+	Stack    string
+	Replaced bool
+}
+
+// WatchdogReport is a HealthStatus with a dump of every goroutine, in the
+// format of runtime.Stack, taken when the check found the problem.
+type WatchdogReport struct {
+	HealthStatus
+	Goroutines string
+}
+
+// WithWatchdog watches the workers of every Run, as Health reports. Stuck
+// workers are also logged as EventStuck and, if replaced, EventReplaced.
+func WithWatchdog(wd Watchdog) Option {
+	return func(s *Scheduler) {
+		if wd.Threshold <= 0 {
+			wd.Threshold = time.Minute
+		}
+
+		if wd.Interval <= 0 {
+			wd.Interval = wd.Threshold / 4
+		}
+
+		s.watchdog = &wd
+	}
+}
+
+// Health returns the latest status of the Runs in progress, the worst of them
+// when there are several. Without Runs in progress it is Healthy.
+func (s *Scheduler) Health() HealthStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := HealthStatus{Replaced: s.replaced}
+
+	for p := range s.pools {
+		if p.health.Health > status.Health {
+			status.Health = p.health.Health
+		}
+
+		if p.health.Checked.After(status.Checked) {
+			status.Checked = p.health.Checked
+		}
+
+		if status.LastProgress.IsZero() || p.health.LastProgress.Before(status.LastProgress) {
+			status.LastProgress = p.health.LastProgress
+		}
+
+		status.Stuck = append(status.Stuck, p.health.Stuck...)
+	}
+
+	return status
+}
+
+// HealthHandler serves Health as JSON, with a 503 status code while stalled.
+func (s *Scheduler) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := s.Health()
+
+		w.Header().Set("Content-Type", "application/json")
+		if status.Health == Stalled {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// heartbeat is what a worker is doing, for the watchdog to read. The worker
+// runs batch[next] and stops before batch[cut], which replacing it brings
+// forward to hand the rest of the batch back to Run.
+type heartbeat struct {
+	mu       sync.Mutex
+	phase    WorkerPhase
+	id       JobID
+	attempt  int
+	since    time.Time
+	batch    []jobRequest
+	next     int
+	cut      int
+	replaced bool
+}
+
+func (w *worker) beat(phase WorkerPhase, id JobID, attempt int) {
+	if w.watchdog == nil {
+		return
+	}
+
+	w.heartbeat.mu.Lock()
+	defer w.heartbeat.mu.Unlock()
+
+	w.heartbeat.phase, w.heartbeat.id, w.heartbeat.attempt = phase, id, attempt
+	w.heartbeat.since = time.Now()
+}
+
+func (w *worker) hold(batch []jobRequest) {
+	if w.watchdog == nil {
+		return
+	}
+
+	w.heartbeat.mu.Lock()
+	defer w.heartbeat.mu.Unlock()
+
+	w.heartbeat.batch, w.heartbeat.next, w.heartbeat.cut = batch, 0, len(batch)
+}
+
+// proceed tells whether the worker still runs batch[i], which it is about to.
+func (w *worker) proceed(i int) bool {
+	if w.watchdog == nil {
+		return true
+	}
+
+	w.heartbeat.mu.Lock()
+	defer w.heartbeat.mu.Unlock()
+
+	w.heartbeat.next = i
+
+	return i < w.heartbeat.cut
+}
+
+// report sends a batch's completions to Run, returning false if the worker
+// was replaced meanwhile and must exit.
+func (w *worker) report(resultStream chan []jobCompletion, completions []jobCompletion) bool {
+	if w.watchdog == nil {
+		resultStream <- completions
+		return true
+	}
+
+	w.heartbeat.mu.Lock()
+	w.heartbeat.phase, w.heartbeat.id, w.heartbeat.attempt = PhaseReporting, "", 0
+	w.heartbeat.since = time.Now()
+	replaced := w.heartbeat.replaced
+	w.heartbeat.mu.Unlock()
+
+	if replaced {
+		// Run takes the stuck job off its count of jobs in flight as it
+		// receives it
+		atomic.AddInt64(&w.pool.abandoned, -1)
+	}
+
+	resultStream <- completions
+	w.beat(PhaseIdle, "", 0)
+
+	return !replaced
+}
+
+// progressed records that Run dispatched or collected something, with queued
+// batches left to dispatch.
+func (p *workerPool) progressed(queued int) {
+	if p.instruments.watchdog == nil {
+		return
+	}
+
+	atomic.StoreInt64(&p.progress, time.Now().UnixNano())
+	atomic.StoreInt64(&p.queued, int64(queued))
+}
+
+// inFlight discounts from Run's count of jobs in flight the jobs replaced
+// workers are stuck on, until they report them, and those they handed back,
+// which Run counts again as it dispatches them anew.
+func (p *workerPool) inFlight(jobs int) int {
+	return jobs - int(atomic.LoadInt64(&p.abandoned))
+}
+
+func (s *Scheduler) watch(p *workerPool) {
+	defer close(p.watched)
+
+	ticker := time.NewTicker(s.watchdog.Interval)
+	defer ticker.Stop()
+
+	reported := make(map[*worker]StuckWorker)
+	stalled := false
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			stalled = s.check(p, now, reported, stalled)
+		}
+	}
+}
+
+// check updates the pool's health, reporting and possibly replacing the
+// workers found stuck for the first time in their current phase. It returns
+// whether the Run is stalled, which is reported once until it progresses.
+func (s *Scheduler) check(p *workerPool, now time.Time, reported map[*worker]StuckWorker, wasStalled bool) bool {
+	wd := s.watchdog
+
+	s.mu.Lock()
+	workers := p.workers[:0]
+	for _, w := range p.workers {
+		if phase, _ := w.beating(); phase != phaseExited {
+			workers = append(workers, w)
+		} else {
+			delete(reported, w)
+		}
+	}
+	p.workers = workers
+	workers = append([]*worker(nil), workers...)
+	s.mu.Unlock()
+
+	status := HealthStatus{
+		Checked:      now,
+		LastProgress: time.Unix(0, atomic.LoadInt64(&p.progress)),
+	}
+	busy := atomic.LoadInt64(&p.queued) > 0
+	found := false
+
+	for _, w := range workers {
+		phase, stuck := w.beating()
+		if phase == PhaseIdle {
+			delete(reported, w)
+			continue
+		}
+		busy = true
+
+		if now.Sub(stuck.Since) < wd.Threshold {
+			continue
+		}
+
+		if last, ok := reported[w]; ok && last.Phase == stuck.Phase && last.Since.Equal(stuck.Since) {
+			status.Stuck = append(status.Stuck, last)
+			continue
+		}
+
+		found = true
+		stuck.Stack = goroutineStack(atomic.LoadUint64(&w.gid))
+		s.events.emit(EventStuck, stuck.Job, stuck.Attempt, w.id, nil)
+
+		if wd.Replace && s.replace(p, w) {
+			stuck.Replaced = true
+			s.events.emit(EventReplaced, stuck.Job, stuck.Attempt, w.id, nil)
+		}
+
+		reported[w] = stuck
+		status.Stuck = append(status.Stuck, stuck)
+	}
+
+	stalled := busy && now.Sub(status.LastProgress) >= wd.Threshold
+
+	switch {
+	case stalled:
+		status.Health = Stalled
+	case len(status.Stuck) > 0:
+		status.Health = Degraded
+	}
+
+	s.mu.Lock()
+	status.Replaced = s.replaced
+	p.health = status
+	s.mu.Unlock()
+
+	if wd.OnStuck != nil && (found || stalled && !wasStalled) {
+		func() {
+			defer func() {
+				recover()
+			}()
+
+			wd.OnStuck(WatchdogReport{status, string(allStacks())})
+		}()
+	}
+
+	return stalled
+}
+
+// beating returns the worker's phase and, as a StuckWorker, what it is doing.
+func (w *worker) beating() (WorkerPhase, StuckWorker) {
+	w.heartbeat.mu.Lock()
+	defer w.heartbeat.mu.Unlock()
+
+	b := &w.heartbeat
+	return b.phase, StuckWorker{Worker: w.id, Phase: b.phase, Job: b.id, Attempt: b.attempt, Since: b.since, Replaced: b.replaced}
+}
+
+// replace starts a worker in place of w and hands the jobs of w's batch it has
+// not started back to Run. w exits once it has reported the rest. It returns
+// false once the Run is over.
+func (s *Scheduler) replace(p *workerPool, w *worker) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, running := s.pools[p]; !running {
+		return false
+	}
+
+	w.heartbeat.mu.Lock()
+	defer w.heartbeat.mu.Unlock()
+
+	if w.heartbeat.replaced || w.heartbeat.phase != PhaseRunning {
+		return false
+	}
+	w.heartbeat.replaced = true
+
+	b := &w.heartbeat
+	rest := append([]jobRequest(nil), b.batch[b.next+1:b.cut]...)
+	b.cut = b.next + 1
+
+	atomic.AddInt64(&p.abandoned, int64(len(rest)+1))
+	p.delayed.push(rest...)
+	p.spawn()
+	s.replaced++
+
+	// Wake Run, which may be holding back work for lack of capacity
+	select {
+	case p.resized <- struct{}{}:
+	default:
+	}
+
+	return true
+}
@@ -0,0 +1,150 @@
+package part10_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	. "part10"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler_should_replace_workers_stuck_on_a_job(t *testing.T) {
+	var mu sync.Mutex
+	var reports []WatchdogReport
+
+	var events bytes.Buffer
+	s := NewScheduler(1, 0, WithEventLog(&events), WithWatchdog(Watchdog{
+		Threshold: 20 * time.Millisecond,
+		Replace:   true,
+		OnStuck: func(report WatchdogReport) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			reports = append(reports, report)
+		},
+	}))
+
+	ran, abort := make(chan struct{}), make(chan struct{})
+	var health HealthStatus
+
+	// 8 jobs make batches of two, so the second job is queued behind the first
+	stuck := s.Add(func() interface{} {
+		// Only a replacement worker can run the second job
+		select {
+		case <-ran:
+		case <-abort:
+		}
+		return 0
+	})
+	s.Add(func() interface{} {
+		health = s.Health()
+		close(ran)
+		return 1
+	})
+	for i := 2; i < 8; i++ {
+		s.Add(constant(i))
+	}
+
+	done := make(chan []Result)
+	go func() {
+		done <- s.Run()
+	}()
+
+	var actual []Result
+	select {
+	case actual = <-done:
+	case <-time.After(5 * time.Second):
+		close(abort)
+		t.Fatalf("Run did not finish, with the scheduler %v", s.Health().Health)
+	}
+
+	for i, result := range actual {
+		if result.Value != i {
+			t.Fatalf("Wanted every job to complete, got %v", values(actual))
+		}
+	}
+
+	if health.Health == Healthy || len(health.Stuck) != 1 {
+		t.Fatalf("Wanted the first worker stuck, got %+v", health)
+	}
+
+	if w := health.Stuck[0]; w.Worker != 1 || w.Job != stuck || w.Phase != PhaseRunning || !w.Replaced {
+		t.Errorf("Wanted worker 1 replaced while running %v, got %+v", stuck, w)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var report WatchdogReport
+	for _, r := range reports {
+		if len(r.Stuck) > 0 {
+			report = r
+			break
+		}
+	}
+
+	if len(report.Stuck) == 0 {
+		t.Fatalf("Wanted the stuck worker reported, got %+v", reports)
+	}
+	if !strings.Contains(report.Stuck[0].Stack, "TestScheduler_should_replace_workers_stuck_on_a_job") {
+		t.Errorf("Wanted the stuck worker's stack, got %q", report.Stuck[0].Stack)
+	}
+
+	if !strings.HasPrefix(report.Goroutines, "goroutine ") || !strings.Contains(report.Goroutines, "\ngoroutine ") {
+		t.Errorf("Wanted a dump of every goroutine, got %q", report.Goroutines)
+	}
+
+	if after := s.Health(); after.Health != Healthy || after.Replaced != 1 || len(after.Stuck) != 0 {
+		t.Errorf("Wanted a healthy scheduler with a worker replaced, got %+v", after)
+	}
+
+	logged, _ := ReadEvents(&events)
+	types := eventTypes(logged, stuck)
+	if !strings.Contains(types, "started stuck replaced") {
+		t.Errorf("Wanted the stuck worker logged and replaced, got %v", types)
+	}
+}
+
+func TestScheduler_should_report_stalled_runs(t *testing.T) {
+	var s *Scheduler
+
+	stalled := make(chan int, 1)
+	held := false
+	hooks := Hooks{
+		OnComplete: func(event JobEvent) {
+			if held {
+				return
+			}
+			held = true
+
+			// Hold up the Run until the watchdog notices
+			deadline := time.Now().Add(5 * time.Second)
+			for s.Health().Health != Stalled && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			response := httptest.NewRecorder()
+			s.HealthHandler().ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+			stalled <- response.Code
+		},
+	}
+
+	s = NewScheduler(1, 0, WithHooks(hooks), WithWatchdog(Watchdog{Threshold: 20 * time.Millisecond}))
+
+	for i := 0; i < 3; i++ {
+		s.Add(constant(i))
+	}
+
+	s.Run()
+
+	if code := <-stalled; code != http.StatusServiceUnavailable {
+		t.Errorf("Wanted %v while stalled, got %v", http.StatusServiceUnavailable, code)
+	}
+
+	if health := s.Health(); health.Health != Healthy {
+		t.Errorf("Wanted %v once the Run is over, got %v", Healthy, health.Health)
+	}
+}